@@ -3,6 +3,7 @@ package gig
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/izuojian/gig/binding"
@@ -14,8 +15,10 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 type H map[string]interface{}
@@ -37,8 +40,11 @@ type Context struct {
 	// 持有engine
 	engine *Engine
 
-	// 路由参数
-	Params map[string]string
+	// 路由参数，请求结束后会被回收复用
+	Params Params
+
+	// 匹配到的路由，未匹配时为 nil
+	route *Route
 
 	// 响应状态码
 	StatusCode int
@@ -76,21 +82,48 @@ type Context struct {
 /********** CONTEXT 操作 ************/
 /************************************/
 
-// newContext 构造方法
-func newContext(w http.ResponseWriter, req *http.Request) *Context {
-	return &Context{
-		Writer:        w,
-		Request:       req,
-		StatusCode:    defaultStatus,
-		Params:        nil,
-		handlers:      nil,
-		index:         -1,
-		Keys:          nil,
-		Errors:        nil,
-		queryCache:    nil,
-		postFormCache: nil,
-		formCache:     nil,
+// reset 重置从对象池取出的 Context，Params 和 Errors 复用之前分配的内存
+func (c *Context) reset(w http.ResponseWriter, req *http.Request) {
+	c.Writer = w
+	c.Request = req
+	c.Params = c.Params[:0]
+	c.route = nil
+	c.StatusCode = defaultStatus
+	c.handlers = nil
+	c.index = -1
+	c.Errors = c.Errors[:0]
+	c.queryCache = nil
+	c.postFormCache = nil
+	c.formCache = nil
+	c.Keys = nil
+	c.sameSite = 0
+}
+
+// Copy 返回当前 Context 的只读副本，请求结束后 Context 会被回收复用，
+// 在 goroutine 中使用时必须使用副本。副本不能写响应，也不能继续执行处理链
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Request:    c.Request,
+		engine:     c.engine,
+		route:      c.route,
+		StatusCode: c.StatusCode,
+		index:      abortIndex,
+		sameSite:   c.sameSite,
+	}
+	cp.Params = make(Params, len(c.Params))
+	copy(cp.Params, c.Params)
+	cp.Errors = make(errorMsgs, len(c.Errors))
+	copy(cp.Errors, c.Errors)
+
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
 	}
+	c.mu.RUnlock()
+	return cp
 }
 
 /************************************/
@@ -226,11 +259,51 @@ func (c *Context) GetInt64(key string) (i64 int64) {
 /************ INPUT 数据  ************/
 /************************************/
 
+// Route 获取匹配到的路由，可用于在中间件中读取路由元数据，未匹配到路由时返回 nil
+func (c *Context) Route() *Route {
+	return c.route
+}
+
+// FullPath 获取匹配到的路由，如 /users/:id，未匹配到路由时返回空字符串
+// 与请求路径不同，可用于指标和链路追踪等需要低基数路径的场景
+func (c *Context) FullPath() string {
+	if c.route == nil {
+		return ""
+	}
+	return c.route.Path
+}
+
+// ClientCertificate 获取 mTLS 校验通过的客户端证书，非 https 请求或未校验客户端证书时返回 nil
+func (c *Context) ClientCertificate() *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return c.Request.TLS.VerifiedChains[0][0]
+}
+
 // Param 获取路由参数
 // 比如： /a/:name  Param("name")
 func (c *Context) Param(key string) string {
-	value, _ := c.Params[key]
-	return value
+	return c.Params.ByName(key)
+}
+
+// ParamInt 获取int类型的路由参数，配合 :id<int> 这样的约束使用
+func (c *Context) ParamInt(key string) (int, error) {
+	return strconv.Atoi(c.Param(key))
+}
+
+// ParamInt64 获取int64类型的路由参数
+func (c *Context) ParamInt64(key string) (int64, error) {
+	return strconv.ParseInt(c.Param(key), 10, 64)
+}
+
+// ParamUUID 获取UUID格式的路由参数，返回统一转换为小写的UUID
+func (c *Context) ParamUUID(key string) (string, error) {
+	value := c.Param(key)
+	if !isUUID(value) {
+		return "", fmt.Errorf("param %s: invalid uuid %q", key, value)
+	}
+	return strings.ToLower(value), nil
 }
 
 // Query 获取单个Query参数
@@ -430,6 +503,7 @@ func (c *Context) ClientIP() string {
 
 // Redirect 跳转
 func (c *Context) Redirect(status int, localurl string) {
+	c.StatusCode = status
 	http.Redirect(c.Writer, c.Request, localurl, status)
 }
 
@@ -484,18 +558,32 @@ func (c *Context) JSON(code int, obj interface{}) {
 		panic(err)
 	}
 
-	// 从gin借鉴
+	// 只有包含非 ASCII 字符时才需要转义，避免逐字符复制
+	for _, b := range ret {
+		if b >= utf8.RuneSelf {
+			ret = asciiJSON(ret)
+			break
+		}
+	}
+
+	_, err = c.Writer.Write(ret)
+	if err != nil {
+		fmt.Printf("c.Writer.Write error: %v\n", err)
+	}
+}
+
+// 把非 ASCII 字符转义为 \uXXXX，从gin借鉴
+func asciiJSON(ret []byte) []byte {
 	var buffer bytes.Buffer
+	buffer.Grow(len(ret) * 2)
 	for _, r := range bytesconv.BytesToString(ret) {
-		cvt := string(r)
 		if r >= 128 {
-			cvt = fmt.Sprintf("\\u%04x", int64(r))
+			_, _ = fmt.Fprintf(&buffer, "\\u%04x", int64(r))
+			continue
 		}
-		buffer.WriteString(cvt)
+		buffer.WriteRune(r)
 	}
-
-	_, err = c.Writer.Write(buffer.Bytes())
-	panic(err)
+	return buffer.Bytes()
 }
 
 // HTML 响应HTML格式数据
@@ -503,7 +591,7 @@ func (c *Context) JSON(code int, obj interface{}) {
 func (c *Context) HTML(code int, name string, data interface{}) {
 	c.Header("Content-Type", "text/html")
 	c.Status(code)
-	if err := ExecuteTemplate(c.Writer, name, data); err != nil {
+	if err := c.engine.executeTemplate(c.Writer, name, data); err != nil {
 		c.Fail(http.StatusInternalServerError, err.Error())
 	}
 }
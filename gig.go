@@ -1,8 +1,11 @@
 package gig
 
 import (
+	"context"
+	"html/template"
 	"net/http"
-	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // 默认最大Multipart内存占用
@@ -13,9 +16,25 @@ type HandlerFunc func(*Context)
 
 // 定义Engine，实现ServeHTPP接口
 type Engine struct {
-	*RouterGroup                // 继承了分组的所有属性和方法
-	router       *router        // 路由
-	groups       []*RouterGroup // 全部分组
+	*RouterGroup // 继承了分组的所有属性和方法
+
+	mu       sync.Mutex   // 保护 table 和 pending
+	updating sync.Mutex   // 保证 UpdateRoutes 依次执行
+	table    *routeTable  // 最新的路由表，可能尚未发布
+	pending  *routeTable  // UpdateRoutes 执行期间新建的路由表
+	current  atomic.Value // ServeHTTP 使用的只读 *router，整体原子替换
+	dirty    int32        // table 是否有未发布的修改
+
+	pool sync.Pool // Context 对象池
+
+	onStart    []HookFunc // 服务启动钩子
+	onShutdown []HookFunc // 服务关闭钩子
+
+	templates map[string]*template.Template // Templates 加载的模板，由 templatesLock 保护
+
+	noRoute  []HandlerFunc // 自定义的 404 处理链，由 mu 保护
+	noMethod []HandlerFunc // 自定义的 405 处理链，由 mu 保护
+	options  []HandlerFunc // 自定义的 OPTIONS 自动响应处理链，由 mu 保护
 
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
@@ -24,7 +43,41 @@ type Engine struct {
 	// If no other Method is allowed, the request is delegated to the NotFound
 	// handler.
 	HandleMethodNotAllowed bool
-	ForwardedByClientIP    bool
+
+	// Enables automatic redirection if the current route can't be matched but a
+	// handler for the path with (without) the trailing slash exists.
+	// For example if /foo/ is requested but a route only exists for /foo, the
+	// client is redirected to /foo with http status code 301 for GET requests
+	// and 308 for all other request methods.
+	RedirectTrailingSlash bool
+
+	// If enabled, the router tries to fix the current request path, if no
+	// handle is registered for it.
+	// First superfluous path elements like ../ or // are removed.
+	// Afterwards the router does a case-insensitive lookup of the cleaned path.
+	// If a handle can be found for this route, the router makes a redirection
+	// to the corrected path with status code 301 for GET requests and 308 for
+	// all other request methods.
+	// For example /FOO and /..//Foo could be redirected to /foo.
+	// RedirectTrailingSlash is independent of this option.
+	RedirectFixedPath bool
+
+	// If enabled, the router automatically replies to OPTIONS requests for
+	// any path registered under some other method, filling the 'Allow' header.
+	// Custom OPTIONS handlers take priority over automatic replies.
+	// See GlobalOPTIONS for taking over the response, e.g. for CORS preflight.
+	HandleOPTIONS bool
+
+	// If enabled, the url.RawPath will be used to find parameters, so that
+	// an encoded slash such as %2F inside a parameter does not split the path.
+	UseRawPath bool
+
+	// If true, the path value will be unescaped.
+	// If UseRawPath is false (by default), the UnescapePathValues effectively is true,
+	// as url.Path gonna be used, which is already unescaped.
+	UnescapePathValues bool
+
+	ForwardedByClientIP bool
 
 	// #726 #755 If enabled, it will thrust some headers starting with
 	// 'X-AppEngine...' for better integration with that PaaS.
@@ -38,15 +91,20 @@ type Engine struct {
 // 创建一个新的引擎
 func New() *Engine {
 	engine := &Engine{
-		router:              newRouter(),
-		ForwardedByClientIP: true,
-		AppEngine:           false,
-		MaxMultipartMemory:  defaultMultipartMemory,
+		RedirectTrailingSlash: true,
+		RedirectFixedPath:     false,
+		UnescapePathValues:    true,
+		ForwardedByClientIP:   true,
+		AppEngine:             false,
+		MaxMultipartMemory:    defaultMultipartMemory,
 	}
 	engine.RouterGroup = &RouterGroup{
 		engine: engine,
 	}
-	engine.groups = []*RouterGroup{engine.RouterGroup}
+	engine.publish(newRouteTable())
+	engine.pool.New = func() interface{} {
+		return engine.allocateContext()
+	}
 	return engine
 }
 
@@ -57,39 +115,118 @@ func Default() *Engine {
 	return engine
 }
 
+// Use 添加全局中间件，同时作用于 404、405 和 OPTIONS 自动响应处理链
+func (engine *Engine) Use(middlewares ...HandlerFunc) {
+	engine.updateHandlers(func() {
+		engine.RouterGroup.Use(middlewares...)
+	})
+}
+
+// NoRoute 设置未匹配到路由时的 404 处理链，会先经过全局中间件
+// 处理链需要自行写入响应状态码和内容，如 c.JSON(http.StatusNotFound, H{"message": "not found"})
+func (engine *Engine) NoRoute(handlers ...HandlerFunc) {
+	engine.updateHandlers(func() {
+		engine.noRoute = handlers
+	})
+}
+
+// NoMethod 设置 HandleMethodNotAllowed 开启时 405 的处理链
+// 执行前已设置好 Allow 响应头，处理链需要自行写入响应状态码和内容
+func (engine *Engine) NoMethod(handlers ...HandlerFunc) {
+	engine.updateHandlers(func() {
+		engine.noMethod = handlers
+	})
+}
+
+// GlobalOPTIONS 设置 HandleOPTIONS 开启时自动响应 OPTIONS 请求的处理链
+// 执行前已设置好 Allow 响应头，可用于 CORS 预检请求：
+//
+//	engine.GlobalOPTIONS(func(c *gig.Context) {
+//	    c.Header("Access-Control-Allow-Methods", c.Writer.Header().Get("Allow"))
+//	    c.Status(http.StatusNoContent)
+//	})
+func (engine *Engine) GlobalOPTIONS(handlers ...HandlerFunc) {
+	engine.updateHandlers(func() {
+		engine.options = handlers
+	})
+}
+
+// 修改全局中间件或 404、405、OPTIONS 处理链，合并后的处理链在下一次获取路由时随 router 一并发布
+func (engine *Engine) updateHandlers(fn func()) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	fn()
+	atomic.StoreInt32(&engine.dirty, 1)
+}
+
+// 合并全局中间件和 404、405、OPTIONS 处理链，未设置时使用默认处理方法
+func (engine *Engine) combineFallback(handlers []HandlerFunc, defaultHandler HandlerFunc) []HandlerFunc {
+	if len(handlers) == 0 {
+		handlers = []HandlerFunc{defaultHandler}
+	}
+	return engine.combineHandlers(handlers)
+}
+
+// 默认的 404 处理方法
+func defaultNoRoute(c *Context) {
+	c.String(http.StatusNotFound, "404 NOT FOUND: %s \n", c.Request.URL.Path)
+}
+
+// 默认的 405 处理方法
+func defaultNoMethod(c *Context) {
+	c.String(http.StatusMethodNotAllowed, "405 METHOD NOT ALLOWED: %s \n", c.Request.URL.Path)
+}
+
+// 默认的 OPTIONS 自动响应方法，只返回 Allow 响应头
+func defaultOptions(c *Context) {
+	c.Status(http.StatusNoContent)
+}
+
 // AddFuncMap
 func (engine *Engine) AddFuncMap(key string, fn interface{}) error {
 	return AddFuncMap(key, fn)
 }
 
-// 加载全部模板文件
+// 加载全部模板文件，模板中可以使用 urlfor 生成该 engine 中命名路由的URL，如 {{urlfor "user.show" "id" .ID}}
+// 该 engine 的 Context.HTML 只使用自己加载的模板；模板同时注册到 ExecuteTemplate 使用的全局模板中，
+// 多个 engine 加载同名模板时全局模板以最后加载的为准
 func (engine *Engine) Templates(viewPath string) {
-	if err := LoadTemplates(viewPath); err != nil {
+	templates, err := buildTemplates(viewPath, engine.tplFuncMap())
+	if err != nil {
 		panic("Load Templates error:" + err.Error())
 	}
+
+	templatesLock.Lock()
+	defer templatesLock.Unlock()
+	if engine.templates == nil {
+		engine.templates = make(map[string]*template.Template, len(templates))
+	}
+	for file, t := range templates {
+		engine.templates[file] = t
+		gigTemplates[file] = t
+	}
 }
 
-// 运行http server
+// 运行http server，收到 SIGINT 或 SIGTERM 时优雅关闭，更多配置见 RunWithContext
 func (engine *Engine) Run(addr string) (err error) {
-	debugPrint("Running in \"%s\" mode", Mode())
-	debugPrint("HTTP server running on%s %s %s", ConsoleFrontColorCyan, addr, ConsoleFrontColorReset)
-	return http.ListenAndServe(addr, engine)
+	return engine.RunWithContext(context.Background(), ServerConfig{Addr: addr})
 }
 
 // 实现ServeHTTP
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	middlewares := make([]HandlerFunc, 0)
-	for _, group := range engine.groups {
-		// 把所有分组包括嵌套分组的中间件都保存下来，后面依次执行
-		// 如 req.URL.Path：/v1/v2/v3/login，则需要执行分组 v1 v2 v3的所有中间件
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
-		}
-	}
+	// 分组中间件在注册路由时已经合并到路由节点上，这里只需执行匹配到的处理链
+	ctx := engine.pool.Get().(*Context)
+	ctx.reset(w, req)
 
-	ctx := newContext(w, req)
-	ctx.handlers = middlewares
-	ctx.engine = engine
+	engine.getRouter().handle(ctx)
+	engine.pool.Put(ctx)
+}
 
-	engine.router.handle(ctx)
+// 创建 Context，供对象池使用
+func (engine *Engine) allocateContext() *Context {
+	return &Context{
+		engine: engine,
+		Params: make(Params, 0, engine.getRouter().maxParams),
+	}
 }
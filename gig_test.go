@@ -1,6 +1,33 @@
 package gig
 
-import "testing"
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
 
 func TestNestedGroup(t *testing.T) {
 	r := New()
@@ -14,3 +41,1534 @@ func TestNestedGroup(t *testing.T) {
 		t.Fatal("v2 prefix should be /v1/v2")
 	}
 }
+
+func TestRouteMiddleware(t *testing.T) {
+	r := New()
+	var trace []string
+	r.Use(func(c *Context) { trace = append(trace, "global") })
+	auth := func(c *Context) {
+		trace = append(trace, "auth")
+		if c.Query("token") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+	r.GET("/admin", auth, func(c *Context) {
+		trace = append(trace, "handler")
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin?token=1", nil))
+	if w.Code != http.StatusOK || strings.Join(trace, ",") != "global,auth,handler" {
+		t.Fatalf("unexpected handlers chain: %d %v", w.Code, trace)
+	}
+
+	trace = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+	if w.Code != http.StatusUnauthorized || strings.Join(trace, ",") != "global,auth" {
+		t.Fatalf("handler should not run after abort: %d %v", w.Code, trace)
+	}
+}
+
+func TestGroupMiddlewareBinding(t *testing.T) {
+	r := New()
+	var trace []string
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) { trace = append(trace, name) }
+	}
+	r.Use(mark("global"))
+	api := r.Group("/api")
+	api.Use(mark("api"))
+	v1 := api.Group("/v1")
+	v1.Use(mark("v1"))
+	v1.GET("/users", mark("users"))
+	r.GET("/apiv2/users", mark("apiv2"))
+
+	cases := map[string]string{
+		"/api/v1/users": "global,api,v1,users",
+		"/apiv2/users":  "global,apiv2",
+		"/api/unknown":  "global",
+	}
+	for path, want := range cases {
+		trace = nil
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if got := strings.Join(trace, ","); got != want {
+			t.Fatalf("%s should run %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestHandleMethodNotAllowed(t *testing.T) {
+	r := New()
+	ok := func(c *Context) { c.String(http.StatusOK, "ok") }
+	r.GET("/users/:id", ok)
+	r.PUT("/users/:id", ok)
+	r.DELETE("/users/:id", ok)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status should be 404 when HandleMethodNotAllowed is off, got %d", w.Code)
+	}
+
+	r.HandleMethodNotAllowed = true
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/1", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status should be 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, PUT" {
+		t.Fatalf("unexpected Allow header: %s", allow)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/posts/1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status should be 404 for unknown path, got %d", w.Code)
+	}
+
+	r.NoMethod(func(c *Context) {
+		c.String(http.StatusMethodNotAllowed, "custom")
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/1", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "custom" {
+		t.Fatalf("custom NoMethod handler should be used, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	r := New()
+	var trace []string
+	r.Use(func(c *Context) { trace = append(trace, "global") })
+	r.Group("/api").Use(func(c *Context) { trace = append(trace, "api") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/missing", nil))
+	if w.Code != http.StatusNotFound || strings.Join(trace, ",") != "global" {
+		t.Fatalf("default 404 should only run global middleware: %d %v", w.Code, trace)
+	}
+
+	r.NoRoute(func(c *Context) {
+		c.JSON(http.StatusNotFound, H{"message": "not found"})
+	})
+	trace = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("custom NoRoute handler should render JSON: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != `{"message":"not found"}` || strings.Join(trace, ",") != "global" {
+		t.Fatalf("unexpected 404 response: %s %v", w.Body.String(), trace)
+	}
+
+	// 服务运行期间修改全局中间件和 404 处理链，与 ServeHTTP 并发执行
+	r = New()
+	r.Host("api.example.com").GET("/ping", func(c *Context) {})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "http://api.example.com/missing", nil))
+				if w.Code != http.StatusNotFound && w.Code != http.StatusGone {
+					t.Errorf("unexpected fallback status %d", w.Code)
+					return
+				}
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		r.Use(func(c *Context) {})
+		r.NoRoute(func(c *Context) { c.Status(http.StatusGone) })
+	}
+	close(done)
+	wg.Wait()
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "http://api.example.com/missing", nil))
+	if w.Code != http.StatusGone {
+		t.Fatalf("host router should use the published NoRoute handler, got %d", w.Code)
+	}
+}
+
+func TestHandleOPTIONS(t *testing.T) {
+	r := New()
+	ok := func(c *Context) { c.String(http.StatusOK, "ok") }
+	r.GET("/users/:id", ok)
+	r.PUT("/users/:id", ok)
+	r.OPTIONS("/custom", ok)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status should be 404 when HandleOPTIONS is off, got %d", w.Code)
+	}
+
+	r.HandleOPTIONS = true
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, OPTIONS, PUT" {
+		t.Fatalf("unexpected OPTIONS response: %d %s", w.Code, w.Header().Get("Allow"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/custom", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("explicit OPTIONS route should take priority, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status should be 404 for unknown path, got %d", w.Code)
+	}
+
+	r.GlobalOPTIONS(func(c *Context) {
+		c.Header("Access-Control-Allow-Methods", c.Writer.Header().Get("Allow"))
+		c.Status(http.StatusOK)
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Methods") != "GET, OPTIONS, PUT" {
+		t.Fatalf("GlobalOPTIONS handler should take over: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRedirectPath(t *testing.T) {
+	r := New()
+	ok := func(c *Context) { c.String(http.StatusOK, "ok") }
+	r.GET("/users/:id", ok)
+	r.POST("/users/:id", ok)
+	r.GET("/posts/", ok)
+	r.GET("/Docs/Intro", ok)
+
+	type redirectCase struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}
+	check := func(cases []redirectCase) {
+		for _, c := range cases {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+			if w.Code != c.code || w.Header().Get("Location") != c.location {
+				t.Fatalf("%s %s: got %d %s", c.method, c.path, w.Code, w.Header().Get("Location"))
+			}
+		}
+	}
+
+	check([]redirectCase{
+		{"GET", "/users/1", http.StatusOK, ""},
+		{"GET", "/users/1/?a=b", http.StatusMovedPermanently, "/users/1?a=b"},
+		{"POST", "/users/1/", http.StatusPermanentRedirect, "/users/1"},
+		{"GET", "/posts", http.StatusMovedPermanently, "/posts/"},
+		{"GET", "//users///1", http.StatusNotFound, ""},
+		{"GET", "/docs/intro", http.StatusNotFound, ""},
+	})
+
+	r.RedirectFixedPath = true
+	check([]redirectCase{
+		{"GET", "//users///1", http.StatusMovedPermanently, "/users/1"},
+		{"GET", "/docs/../DOCS/intro/", http.StatusMovedPermanently, "/Docs/Intro"},
+	})
+
+	r.RedirectTrailingSlash = false
+	check([]redirectCase{
+		{"GET", "/posts", http.StatusNotFound, ""},
+	})
+}
+
+func TestContextTypedParams(t *testing.T) {
+	r := New()
+	r.GET("/users/:id<int>/:token", func(c *Context) {
+		id, err := c.ParamInt("id")
+		if err != nil || id != 42 {
+			t.Fatalf("ParamInt should be 42, got %d %v", id, err)
+		}
+		id64, err := c.ParamInt64("id")
+		if err != nil || id64 != 42 {
+			t.Fatalf("ParamInt64 should be 42, got %d %v", id64, err)
+		}
+		if _, err := c.ParamInt("token"); err == nil {
+			t.Fatal("ParamInt should fail for non-numeric token")
+		}
+		if _, err := c.ParamUUID("token"); err == nil {
+			t.Fatal("ParamUUID should fail for non-uuid token")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/files/:uid<uuid>", func(c *Context) {
+		uid, err := c.ParamUUID("uid")
+		if err != nil || uid != "5f1d3a3e-0b7c-4a43-9d1e-2b6a8f0c9e11" {
+			t.Fatalf("unexpected uuid %s %v", uid, err)
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/users/42/abc", "/files/5F1D3A3E-0B7C-4A43-9D1E-2B6A8F0C9E11"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s should be matched, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	r := New()
+	ok := func(c *Context) {}
+	v1 := r.Group("/v1")
+	v1.GET("/users/:id", ok).Name("user.show")
+	v1.PUT("/users/:id", ok).Name("user.show")
+	v1.GET("/files/:name.:ext", ok).Name("file.show")
+	r.GET("/static/*filepath", ok).Name("static")
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		url    string
+	}{
+		{"user.show", []interface{}{"id", 42}, "/v1/users/42"},
+		{"user.show", []interface{}{"id", "a b/c", "tab", "posts"}, "/v1/users/a%20b%2Fc?tab=posts"},
+		{"file.show", []interface{}{"name", "report", "ext", "pdf"}, "/v1/files/report.pdf"},
+		{"static", []interface{}{"filepath", "css/main style.css"}, "/static/css/main%20style.css"},
+	}
+	for _, c := range cases {
+		url, err := r.URLFor(c.name, c.params...)
+		if err != nil || url != c.url {
+			t.Fatalf("URLFor(%s, %v) should be %s, got %s %v", c.name, c.params, c.url, url, err)
+		}
+	}
+
+	if _, err := r.URLFor("user.show"); err == nil {
+		t.Fatal("missing param should return error")
+	}
+	if _, err := r.URLFor("user.show", "id"); err == nil {
+		t.Fatal("odd params should return error")
+	}
+	if _, err := r.URLFor("missing"); err == nil {
+		t.Fatal("unknown route name should return error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate route name should panic")
+		}
+	}()
+	r.GET("/posts/:id", ok).Name("user.show")
+}
+
+func TestURLForTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tpl := `<a href="{{urlfor "user.show" "id" .}}">user</a>`
+	if err := os.WriteFile(filepath.Join(dir, "user.html"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个 engine 的模板使用各自的 urlfor
+	newEngine := func(prefix string) *Engine {
+		r := New()
+		r.GET(prefix+"/:id", func(c *Context) {}).Name("user.show")
+		r.GET("/page/:id", func(c *Context) { c.HTML(http.StatusOK, "user.html", c.Param("id")) })
+		r.Templates(dir)
+		return r
+	}
+	users, members := newEngine("/users"), newEngine("/members")
+	for r, want := range map[*Engine]string{users: `<a href="/users/7">user</a>`, members: `<a href="/members/7">user</a>`} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/page/7", nil))
+		if w.Body.String() != want {
+			t.Fatalf("unexpected template output: %s", w.Body.String())
+		}
+	}
+
+	// Engine.Templates 加载的模板同样可以通过 ExecuteTemplate 渲染，全局模板以最后加载的为准
+	var global strings.Builder
+	if err := ExecuteTemplate(&global, "user.html", 7); err != nil || global.String() != `<a href="/members/7">user</a>` {
+		t.Fatalf("templates loaded by Engine.Templates should be executable globally, got %v %s", err, global.String())
+	}
+
+	// LoadTemplates 加载的模板可以解析，但 urlfor 返回错误
+	if err := LoadTemplates(dir); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := ExecuteTemplate(&b, "user.html", 7); err == nil || !strings.Contains(err.Error(), "Engine.Templates") {
+		t.Fatalf("urlfor in templates loaded by LoadTemplates should fail, got %v", err)
+	}
+}
+
+func handlerForRoutesTest(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {})
+	v1 := r.Group("/v1")
+	v1.Use(func(c *Context) {})
+	v1.GET("/users/:id", func(c *Context) {}, handlerForRoutesTest).Name("user.show")
+	v1.POST("/users", handlerForRoutesTest)
+	r.GET("/", handlerForRoutesTest)
+
+	want := []RouteInfo{
+		{Method: "GET", Path: "/", Handler: "github.com/izuojian/gig.handlerForRoutesTest", Middlewares: 1},
+		{Method: "GET", Path: "/v1/users/:id", Handler: "github.com/izuojian/gig.handlerForRoutesTest", Middlewares: 3, Name: "user.show"},
+		{Method: "POST", Path: "/v1/users", Handler: "github.com/izuojian/gig.handlerForRoutesTest", Middlewares: 2},
+	}
+	if routes := r.Routes(); !reflect.DeepEqual(routes, want) {
+		t.Fatalf("unexpected routes: %+v", routes)
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	r := New()
+	reply := func(body string) HandlerFunc {
+		return func(c *Context) {
+			c.String(http.StatusOK, body+c.Param("tenant")+c.Param("id"))
+		}
+	}
+	r.GET("/users/:id", reply("default:"))
+	r.Host("api.example.com").GET("/users/:id", reply("api:")).Name("api.user")
+	r.Host("{tenant}.example.com").Group("/v1").GET("/users/:id", reply("tenant:"))
+	r.Host("admin.example.com").GET("/", reply("admin"))
+
+	cases := []struct {
+		host string
+		path string
+		code int
+		body string
+	}{
+		{"api.example.com", "/users/1", http.StatusOK, "api:1"},
+		{"API.example.com:8080", "/users/1", http.StatusOK, "api:1"},
+		{"acme.example.com", "/v1/users/2", http.StatusOK, "tenant:acme2"},
+		{"acme.example.com", "/users/2", http.StatusNotFound, ""},
+		{"admin.example.com", "/", http.StatusOK, "admin"},
+		{"a.b.example.com", "/users/3", http.StatusOK, "default:3"},
+		{"localhost", "/users/3", http.StatusOK, "default:3"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Host = c.host
+		r.ServeHTTP(w, req)
+		if w.Code != c.code || (c.code == http.StatusOK && w.Body.String() != c.body) {
+			t.Fatalf("%s%s: got %d %s", c.host, c.path, w.Code, w.Body.String())
+		}
+	}
+
+	hosts := make([]string, 0)
+	for _, route := range r.Routes() {
+		hosts = append(hosts, route.Host)
+	}
+	if strings.Join(hosts, ",") != ",api.example.com,admin.example.com,{tenant}.example.com" {
+		t.Fatalf("unexpected route hosts: %v", hosts)
+	}
+
+	// 路由名称只属于命名时所在 Host 下的路由
+	named := make([]string, 0)
+	for _, route := range r.Routes() {
+		if route.Name != "" {
+			named = append(named, route.Host+route.Path+"="+route.Name)
+		}
+	}
+	if strings.Join(named, ",") != "api.example.com/users/:id=api.user" {
+		t.Fatalf("route name should only be attached to the named host route: %v", named)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("same name on another host should panic")
+			}
+		}()
+		r.GET("/orders/:id", reply("default:")).Name("api.user")
+	}()
+	if !r.Host("api.example.com").RemoveRoute("GET", "/users/:id") {
+		t.Fatal("host route should be removed")
+	}
+	if _, err := r.URLFor("api.user"); err == nil {
+		t.Fatal("name should be removed with its host route even if the default route remains")
+	}
+}
+
+func TestMount(t *testing.T) {
+	r := New()
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(req.Method + " " + req.URL.Path + "?" + req.URL.RawQuery))
+	})
+	r.Mount("/raw", echo)
+
+	sub := New()
+	sub.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "sub user "+c.Param("id")) })
+	r.Group("/tenants/:tenant").Mount("/app", sub)
+
+	r.GET("/f", WrapF(echo))
+	r.GET("/h/*any", WrapH(echo))
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/raw", http.StatusOK, "GET /?"},
+		{"GET", "/raw/", http.StatusOK, "GET /?"},
+		{"DELETE", "/raw/a/b?x=1", http.StatusOK, "DELETE /a/b?x=1"},
+		{"GET", "/tenants/acme/app/users/1", http.StatusOK, "sub user 1"},
+		{"GET", "/tenants/acme/app/missing", http.StatusNotFound, ""},
+		{"GET", "/f?y=2", http.StatusOK, "GET /f?y=2"},
+		{"GET", "/h/a/b", http.StatusOK, "GET /h/a/b?"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.code || (c.code == http.StatusOK && w.Body.String() != c.body) {
+			t.Fatalf("%s %s: got %d %s", c.method, c.path, w.Code, w.Body.String())
+		}
+	}
+
+	for _, route := range r.Routes() {
+		if route.Path == "/raw/*path" && route.Handler != "http.HandlerFunc" {
+			t.Fatalf("mounted handler name should be its type, got %s", route.Handler)
+		}
+	}
+
+	// 挂载的 *Engine 跳转到包含挂载前缀的路径
+	admin := New()
+	admin.RedirectFixedPath = true
+	admin.GET("/users", func(c *Context) { c.String(http.StatusOK, "users") })
+	r.Mount("/admin", admin)
+	r.Group("/tenants/:tenant").Mount("/admin", admin)
+	outer := New()
+	outer.Mount("/outer", r)
+	for _, c := range []struct {
+		engine   *Engine
+		path     string
+		location string
+	}{
+		{r, "/admin/users/", "/admin/users"},
+		{r, "/admin/USERS?a=1", "/admin/users?a=1"},
+		{r, "/tenants/acme/admin/users/", "/tenants/acme/admin/users"},
+		{outer, "/outer/admin/users/", "/outer/admin/users"},
+	} {
+		w := httptest.NewRecorder()
+		c.engine.ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != c.location {
+			t.Fatalf("%s should redirect to %s, got %d %s", c.path, c.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// 按转义后的路径匹配时，挂载的 handler 收到解码后的 Path 和转义的 RawPath
+	rawEcho := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(req.URL.Path + " " + req.URL.EscapedPath()))
+	})
+	for _, unescape := range []bool{false, true} {
+		r := New()
+		r.UseRawPath = true
+		r.UnescapePathValues = unescape
+		r.Mount("/files", rawEcho)
+		r.Group("/buckets/:bucket").Mount("/", rawEcho)
+		for path, body := range map[string]string{
+			"/files/a%2Fb":         "/a/b /a%2Fb",
+			"/files/a%2Fb/c%20d":   "/a/b/c d /a%2Fb/c%20d",
+			"/buckets/x%2Fy/a%2Fb": "/a/b /a%2Fb",
+			"/files/plain":         "/plain /plain",
+		} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if w.Body.String() != body {
+				t.Fatalf("UnescapePathValues=%t %s: mounted handler should get %q, got %q", unescape, path, body, w.Body.String())
+			}
+		}
+	}
+}
+
+type photoController struct{}
+
+func (photoController) Index(c *Context)   { c.String(http.StatusOK, "photos") }
+func (photoController) New(c *Context)     { c.String(http.StatusOK, "new photo") }
+func (photoController) Create(c *Context)  { c.String(http.StatusCreated, "created") }
+func (photoController) Show(c *Context)    { c.String(http.StatusOK, "photo "+c.Param("id")) }
+func (photoController) Edit(c *Context)    { c.String(http.StatusOK, "edit photo "+c.Param("id")) }
+func (photoController) Update(c *Context)  { c.String(http.StatusOK, "update photo "+c.Param("id")) }
+func (photoController) Destroy(c *Context) { c.String(http.StatusOK, "destroy photo "+c.Param("id")) }
+
+type commentController struct{}
+
+func (commentController) Index(c *Context) {
+	c.String(http.StatusOK, "comments of "+c.Param("id"))
+}
+func (commentController) Show(c *Context) {
+	c.String(http.StatusOK, "comment "+c.Param("comment_id")+" of "+c.Param("id"))
+}
+
+func TestResource(t *testing.T) {
+	r := New()
+	r.HandleMethodNotAllowed = true
+	photos := r.Resource("/photos", photoController{})
+	photos.Resource("/comments", commentController{})
+	photos.GET("/likes", func(c *Context) { c.String(http.StatusOK, "likes of "+c.Param("id")) })
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/photos", http.StatusOK, "photos"},
+		{"GET", "/photos/new", http.StatusOK, "new photo"},
+		{"POST", "/photos", http.StatusCreated, "created"},
+		{"GET", "/photos/1", http.StatusOK, "photo 1"},
+		{"GET", "/photos/1/edit", http.StatusOK, "edit photo 1"},
+		{"PUT", "/photos/1", http.StatusOK, "update photo 1"},
+		{"PATCH", "/photos/1", http.StatusOK, "update photo 1"},
+		{"DELETE", "/photos/1", http.StatusOK, "destroy photo 1"},
+		{"GET", "/photos/1/comments", http.StatusOK, "comments of 1"},
+		{"GET", "/photos/1/comments/2", http.StatusOK, "comment 2 of 1"},
+		{"DELETE", "/photos/1/comments/2", http.StatusMethodNotAllowed, ""},
+		{"GET", "/photos/1/comments/new", http.StatusOK, "comment new of 1"},
+		{"GET", "/photos/1/likes", http.StatusOK, "likes of 1"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.code || (c.body != "" && w.Body.String() != c.body) {
+			t.Fatalf("%s %s: got %d %s", c.method, c.path, w.Code, w.Body.String())
+		}
+	}
+
+	for _, route := range r.Routes() {
+		if route.Method == "GET" && route.Path == "/photos/:id" && route.Handler != "gig.photoController.Show" {
+			t.Fatalf("resource handler name should be controller action, got %s", route.Handler)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("controller without actions should panic")
+		}
+	}()
+	r.Resource("/empty", struct{}{})
+}
+
+func TestUpdateRoutes(t *testing.T) {
+	r := New()
+	text := func(body string) HandlerFunc {
+		return func(c *Context) { c.String(http.StatusOK, body) }
+	}
+	r.GET("/a", text("a"))
+	r.GET("/b", text("b")).Name("b")
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	// 服务运行期间并发注册和替换路由
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					if code := status("/b"); code != http.StatusOK {
+						t.Errorf("/b should always be served, got %d", code)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		path := fmt.Sprintf("/runtime/%d", i)
+		r.GET(path, text(path))
+		r.UpdateRoutes(func(rr RouteRegistrar) {
+			rr.RemoveRoute("GET", path)
+			rr.Group("/plugins").GET(fmt.Sprintf("/%d", i), text("plugin"))
+		})
+	}
+	close(done)
+	wg.Wait()
+
+	if code := status("/runtime/1"); code != http.StatusNotFound {
+		t.Fatalf("removed route should be 404, got %d", code)
+	}
+	if code := status("/plugins/19"); code != http.StatusOK {
+		t.Fatalf("route added by UpdateRoutes should be 200, got %d", code)
+	}
+
+	// fn panic 时路由保持不变
+	func() {
+		defer func() { _ = recover() }()
+		r.UpdateRoutes(func(rr RouteRegistrar) {
+			rr.RemoveRoute("GET", "/a")
+			rr.GET("/b", text("conflict"))
+		})
+	}()
+	if code := status("/a"); code != http.StatusOK {
+		t.Fatalf("/a should survive a failed update, got %d", code)
+	}
+
+	if !r.RemoveRoute("GET", "/b") || r.RemoveRoute("GET", "/b") {
+		t.Fatal("RemoveRoute should report whether the route existed")
+	}
+	if _, err := r.URLFor("b"); err == nil {
+		t.Fatal("name of removed route should be removed")
+	}
+	if code := status("/b"); code != http.StatusNotFound {
+		t.Fatalf("/b should be removed, got %d", code)
+	}
+
+	// 发布后继续注册路由时不重新构建路由表，已发布的 router 不受影响
+	published := r.getRouter()
+	table := r.table.router
+	r.GET("/c", text("c")).Name("c")
+	r.Host("api.example.com").GET("/d", text("d"))
+	if r.table.router != table {
+		t.Fatal("registering after publish should not rebuild the route table")
+	}
+	if n, _ := getRoute(published, "GET", "/c"); n != nil {
+		t.Fatal("published router should not be modified")
+	}
+	if code := status("/c"); code != http.StatusOK {
+		t.Fatalf("/c should be published on the next request, got %d", code)
+	}
+}
+
+func TestCustomMethods(t *testing.T) {
+	r := New()
+	r.HandleMethodNotAllowed = true
+	text := func(body string) HandlerFunc {
+		return func(c *Context) { c.String(http.StatusOK, body) }
+	}
+	r.ANY("/any", text("any"))
+	r.Handle("PROPFIND", "/dav/*path", text("propfind"))
+	r.Handle("MKCOL", "/any", text("mkcol"))
+	r.Match([]string{"LOCK", "UNLOCK"}, "/dav/*path", text("lock"))
+	r.Group("/late").ANY("/any", text("late any"))
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"TRACE", "/any", http.StatusOK, "any"},
+		{"CONNECT", "/any", http.StatusOK, "any"},
+		{"PROPFIND", "/any", http.StatusOK, "any"},
+		{"MKCOL", "/any", http.StatusOK, "mkcol"},
+		{"LOCK", "/any", http.StatusOK, "any"},
+		{"MKCOL", "/late/any", http.StatusOK, "late any"},
+		{"PROPFIND", "/dav/a/b", http.StatusOK, "propfind"},
+		{"UNLOCK", "/dav/a", http.StatusOK, "lock"},
+		{"GET", "/dav/a", http.StatusMethodNotAllowed, ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.code || (c.body != "" && w.Body.String() != c.body) {
+			t.Fatalf("%s %s: got %d %s", c.method, c.path, w.Code, w.Body.String())
+		}
+		if c.code == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "LOCK, PROPFIND, UNLOCK" {
+			t.Fatalf("unexpected Allow header %q", w.Header().Get("Allow"))
+		}
+	}
+
+	for _, method := range []string{"", "GET /", "PROP(FIND)", "测试"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("method %q should be invalid", method)
+				}
+			}()
+			r.Handle(method, "/invalid", text("invalid"))
+		}()
+	}
+}
+
+func TestAnyWithExplicitMethods(t *testing.T) {
+	text := func(body string) HandlerFunc {
+		return func(c *Context) { c.String(http.StatusOK, body) }
+	}
+	type step struct{ method, path string }
+	// 单独注册的请求方式优先于 ANY，与注册顺序无关
+	orders := [][]step{
+		{{"ANY", "/x"}, {"PROPFIND", "/x"}},
+		{{"PROPFIND", "/y"}, {"ANY", "/x"}, {"PROPFIND", "/x"}},
+		{{"PROPFIND", "/x"}, {"ANY", "/x"}},
+		{{"GET", "/x"}, {"ANY", "/x"}},
+		{{"ANY", "/x"}, {"GET", "/x"}},
+	}
+	for _, order := range orders {
+		r := New()
+		explicit := ""
+		for _, s := range order {
+			r.Handle(s.method, s.path, text(s.method))
+			if s.method != "ANY" && s.path == "/x" {
+				explicit = s.method
+			}
+		}
+		for _, method := range []string{explicit, "POST"} {
+			want := "ANY"
+			if method == explicit {
+				want = explicit
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, "/x", nil))
+			if w.Code != http.StatusOK || w.Body.String() != want {
+				t.Fatalf("%v: %s /x should be handled by %s, got %d %s", order, method, want, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	for _, c := range [][2]string{{"ANY", "ANY"}, {"GET", "GET"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s /x and %s /x should conflict", c[0], c[1])
+				}
+			}()
+			r := New()
+			r.Handle(c[0], "/x", text(c[0]))
+			r.Handle(c[1], "/x", text(c[1]))
+		}()
+	}
+
+	// 删除单独注册的路由后该请求方式重新由 ANY 处理
+	r := New()
+	r.GET("/x", text("GET"))
+	r.ANY("/x", text("ANY"))
+	r.RemoveRoute("GET", "/x")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/x", nil))
+	if w.Body.String() != "ANY" {
+		t.Fatalf("GET /x should fall back to ANY after removal, got %s", w.Body.String())
+	}
+}
+
+func TestUseRawPath(t *testing.T) {
+	newEngine := func(useRawPath, unescape bool) *Engine {
+		r := New()
+		r.UseRawPath = useRawPath
+		r.UnescapePathValues = unescape
+		r.GET("/objects/:key", func(c *Context) { c.String(http.StatusOK, "%s", c.Param("key")) })
+		r.GET("/objects/:key/meta", func(c *Context) { c.String(http.StatusOK, "meta %s", c.Param("key")) })
+		return r
+	}
+	cases := []struct {
+		useRawPath bool
+		unescape   bool
+		path       string
+		code       int
+		body       string
+	}{
+		{false, true, "/objects/a%2Fb", http.StatusNotFound, ""},
+		{true, true, "/objects/a%2Fb", http.StatusOK, "a/b"},
+		{true, true, "/objects/a%2Fb%20c/meta", http.StatusOK, "meta a/b c"},
+		{true, false, "/objects/a%2Fb", http.StatusOK, "a%2Fb"},
+		{true, true, "/objects/plain", http.StatusOK, "plain"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		newEngine(c.useRawPath, c.unescape).ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != c.code || (c.body != "" && w.Body.String() != c.body) {
+			t.Fatalf("UseRawPath=%t UnescapePathValues=%t %s: got %d %s",
+				c.useRawPath, c.unescape, c.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouteMeta(t *testing.T) {
+	r := New()
+	r.Use(func(c *Context) {
+		if route := c.Route(); route != nil && route.MetaString("scope") == "admin" && c.Query("token") != "admin" {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	})
+	ok := func(c *Context) { c.String(http.StatusOK, "%v", c.Route().Meta("tier")) }
+	r.GET("/admin", ok).SetMeta("scope", "admin").SetMeta("tier", 2)
+	r.GET("/public", ok)
+
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/admin", http.StatusForbidden, ""},
+		{"/admin?token=admin", http.StatusOK, "2"},
+		{"/public", http.StatusOK, "<nil>"},
+		{"/missing", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != c.code || (c.body != "" && w.Body.String() != c.body) {
+			t.Fatalf("%s: got %d %s", c.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestContextFullPath(t *testing.T) {
+	var buf strings.Builder
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{
+		Output: &buf,
+		Formatter: func(param LogFormatterParams) string {
+			return param.FullPath + "|"
+		},
+	}))
+	r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "%s", c.FullPath()) })
+	r.Group("/files").GET("/*path", func(c *Context) { c.String(http.StatusOK, "%s", c.FullPath()) })
+
+	for path, fullPath := range map[string]string{
+		"/users/1":      "/users/:id",
+		"/files/a/b.go": "/files/*path",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != fullPath {
+			t.Fatalf("%s: FullPath should be %s, got %s", path, fullPath, w.Body.String())
+		}
+	}
+
+	buf.Reset()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/2", nil))
+	if buf.String() != "|/users/:id|" {
+		t.Fatalf("logger should record FullPath, got %q", buf.String())
+	}
+}
+
+// 获取一个空闲的本地地址
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestRunWithContext(t *testing.T) {
+	r := New()
+	inFlight := make(chan struct{})
+	r.GET("/slow", func(c *Context) {
+		close(inFlight)
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	var events []string
+	started := make(chan struct{})
+	r.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "db")
+		return nil
+	}, func(ctx context.Context) error {
+		events = append(events, "cache")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr := freeAddr(t)
+	result := make(chan error, 1)
+	go func() {
+		result <- r.RunWithContext(ctx, ServerConfig{Addr: addr, ReadHeaderTimeout: time.Second})
+	}()
+	<-started
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+	<-inFlight
+	cancel()
+
+	if body := <-response; body != "done" {
+		t.Fatalf("in-flight request should be drained, got %s", body)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("graceful shutdown should return nil, got %v", err)
+	}
+	if strings.Join(events, ",") != "cache,db" {
+		t.Fatalf("shutdown hooks should run in reverse order, got %v", events)
+	}
+
+	// 超过 ShutdownTimeout 时返回超时错误
+	r = New()
+	inFlight = make(chan struct{})
+	r.GET("/slow", func(c *Context) {
+		close(inFlight)
+		time.Sleep(time.Second)
+	})
+	ctx, cancel = context.WithCancel(context.Background())
+	addr = freeAddr(t)
+	go func() {
+		result <- r.RunWithContext(ctx, ServerConfig{Addr: addr, ShutdownTimeout: 10 * time.Millisecond})
+	}()
+	for {
+		if resp, err := http.Get("http://" + addr + "/missing"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	go func() { _, _ = http.Get("http://" + addr + "/slow") }()
+	<-inFlight
+	cancel()
+	if err := <-result; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown should time out, got %v", err)
+	}
+
+	// 启动钩子返回错误时服务不启动
+	r = New()
+	hookErr := errors.New("connect db failed")
+	r.OnStart(func(ctx context.Context) error { return hookErr })
+	if err := r.RunWithContext(context.Background(), ServerConfig{Addr: freeAddr(t)}); err != hookErr {
+		t.Fatalf("start hook error should be returned, got %v", err)
+	}
+}
+
+// 测试用的证书，由 ca 签发
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// 签发测试证书，parent 为空时生成自签名的 CA
+func newTestCert(t *testing.T, cn string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// 把证书和私钥写入文件
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certFile, c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tls.Certificate 形式，用作客户端证书
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	ca := newTestCert(t, "test ca", nil, x509.ExtKeyUsageAny)
+	newTestCert(t, "server v1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+
+	// 不完整的 https 配置返回错误，而不是运行 http server
+	for _, config := range []ServerConfig{
+		{CertFile: certFile},
+		{KeyFile: keyFile},
+		{ClientCAFile: caFile},
+		{TLSConfig: &tls.Config{}},
+		{RedirectHTTPAddr: "127.0.0.1:0"},
+	} {
+		config.Addr = "127.0.0.1:0"
+		if err := New().RunWithContext(context.Background(), config); err == nil {
+			t.Fatalf("incomplete TLS config %+v should fail", config)
+		}
+	}
+	if err := os.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	r := New()
+	r.GET("/whoami", func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.Request.Proto, c.ClientCertificate().Subject.CommonName)
+	})
+	started := make(chan struct{})
+	r.OnStart(func(ctx context.Context) error {
+		close(started)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, redirectAddr := freeAddr(t), freeAddr(t)
+	result := make(chan error, 1)
+	go func() {
+		result <- r.RunWithContext(ctx, ServerConfig{
+			Addr:             addr,
+			CertFile:         certFile,
+			KeyFile:          keyFile,
+			ClientCAFile:     caFile,
+			RedirectHTTPAddr: redirectAddr,
+		})
+	}()
+	<-started
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (*http.Response, string, error) {
+		transport := &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}
+		defer transport.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: transport}).Get("https://" + addr + "/whoami")
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body), nil
+	}
+
+	resp, body, err := get(client.tlsCertificate())
+	if err != nil || body != "HTTP/2.0 client" {
+		t.Fatalf("mTLS request should be served over HTTP/2 with client cert, got %q %v", body, err)
+	}
+	if cn := resp.TLS.PeerCertificates[0].Subject.CommonName; cn != "server v1" {
+		t.Fatalf("unexpected server certificate %s", cn)
+	}
+	if _, _, err = get(); err == nil {
+		t.Fatal("request without client certificate should be rejected")
+	}
+
+	// 证书文件更新后新连接使用新证书
+	newTestCert(t, "server v2", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Hour)
+	for _, file := range []string{certFile, keyFile} {
+		if err = os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resp, _, err = get(client.tlsCertificate()); err != nil || resp.TLS.PeerCertificates[0].Subject.CommonName != "server v2" {
+		t.Fatalf("certificate should be reloaded from disk, err %v", err)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = noRedirect.Get("http://" + redirectAddr + "/whoami?a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "https://127.0.0.1:"+port+"/whoami?a=1" {
+		t.Fatalf("http should redirect to https, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	cancel()
+	if err = <-result; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca := newTestCert(t, "test ca", nil, x509.ExtKeyUsageAny)
+	newTestCert(t, "server v1", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{certFile, keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commonName := func() string {
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	// 模拟经过了 certCheckInterval
+	expire := func() {
+		r.mu.Lock()
+		r.checked = time.Now().Add(-certCheckInterval)
+		r.mu.Unlock()
+	}
+
+	// 修改时间不变的重写在检查间隔之后同样会被加载
+	newTestCert(t, "server v2", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	for file, modTime := range modTimes {
+		if err = os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expire()
+	if cn := commonName(); cn != "server v2" {
+		t.Fatalf("rewritten certificate should be reloaded, got %s", cn)
+	}
+
+	// 证书和私钥不匹配时继续使用旧证书，同一份错误的内容只解析一次
+	if err = os.WriteFile(certFile, newTestCert(t, "server v3", ca, x509.ExtKeyUsageServerAuth).pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	expire()
+	if cn := commonName(); cn != "server v2" {
+		t.Fatalf("mismatched key pair should keep the old certificate, got %s", cn)
+	}
+	badErr := r.badErr
+	expire()
+	if cn := commonName(); cn != "server v2" || badErr == nil || r.badErr != badErr {
+		t.Fatalf("mismatched key pair should be parsed only once, got %s %v", cn, r.badErr)
+	}
+
+	// 文件大小或修改时间变化后立即加载
+	newTestCert(t, "server v4", ca, x509.ExtKeyUsageServerAuth).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Hour)
+	for file := range modTimes {
+		if err = os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cn := commonName(); cn != "server v4" {
+		t.Fatalf("changed certificate should be reloaded immediately, got %s", cn)
+	}
+}
+
+func TestRunUnixAndFd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gig.sock")
+
+	// 进程异常退出后残留的 socket 文件
+	stale, err := net.Listen("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ln, err := listenUnix(file, 0600)
+	if err != nil {
+		t.Fatalf("stale socket should be removed, got %v", err)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Fatalf("socket mode should be 0600, got %v", info.Mode().Perm())
+	}
+	if _, err = listenUnix(file, 0600); err == nil {
+		t.Fatal("socket in use should not be removed")
+	}
+
+	// 父进程传入的文件描述符
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdLn, err := fileListener(f.Fd(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tcp.Close()
+
+	r := New()
+	r.GET("/ping", func(c *Context) { c.String(http.StatusOK, "pong") })
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan error, 2)
+	for _, l := range []net.Listener{ln, fdLn} {
+		go func(l net.Listener) {
+			results <- r.RunWithContext(ctx, ServerConfig{Listener: l})
+		}(l)
+	}
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", file)
+		},
+	}}
+	for client, url := range map[*http.Client]string{
+		unixClient:         "http://unix/ping",
+		http.DefaultClient: "http://" + fdLn.Addr().String() + "/ping",
+	} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "pong" {
+			t.Fatalf("%s: got %s", url, body)
+		}
+	}
+	unixClient.CloseIdleConnections()
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err = <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("socket file should be removed after shutdown")
+	}
+}
+
+// systemd socket activation 测试中被启动的服务进程
+func TestSystemdHelperProcess(t *testing.T) {
+	if os.Getenv("GIG_TEST_SYSTEMD") == "" {
+		t.Skip("only run as helper process of TestSystemdListeners")
+	}
+	// LISTEN_PID 不是当前进程时，传入的 socket 不属于当前进程
+	if listeners, err := SystemdListeners(); err != nil || listeners != nil {
+		t.Fatalf("sockets passed to another process should be ignored, got %v %v", listeners, err)
+	}
+	_ = os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	listeners, names, err := systemdListeners()
+	if err != nil || len(listeners) != 2 {
+		t.Fatalf("2 listeners should be passed, got %v %v", listeners, err)
+	}
+	if !reflect.DeepEqual(names, []string{"http", "LISTEN_FD_4"}) {
+		t.Fatalf("unexpected listener names %v", names)
+	}
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(key); ok {
+			t.Fatalf("%s should be unset", key)
+		}
+	}
+
+	r := New()
+	r.GET("/ping", func(c *Context) { c.String(http.StatusOK, "pong") })
+	results := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			results <- r.RunWithContext(context.Background(), ServerConfig{Listener: ln})
+		}(ln)
+	}
+	for range listeners {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket activation is not supported on windows")
+	}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "gig.sock")
+	unix, err := net.Listen("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	// 按 systemd 的方式从文件描述符 3 开始传入 socket，LISTEN_PID 由子进程修正为自己的 pid
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdHelperProcess$", "-test.v")
+	cmd.Env = append(os.Environ(), "GIG_TEST_SYSTEMD=1",
+		"LISTEN_PID="+strconv.Itoa(os.Getpid()), "LISTEN_FDS=2", "LISTEN_FDNAMES=http")
+	for _, ln := range []net.Listener{tcp, unix} {
+		f, err := ln.(interface{ File() (*os.File, error) }).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+	var out strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+	addr := tcp.Addr().String()
+	_ = tcp.Close()
+	_ = unix.Close()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", file)
+		},
+	}}
+	for _, client := range []*http.Client{http.DefaultClient, unixClient} {
+		body := ""
+		for i := 0; i < 500 && body != "pong"; i++ {
+			if resp, err := client.Get("http://" + addr + "/ping"); err == nil {
+				b, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				body = string(b)
+			} else {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		if body != "pong" {
+			t.Fatalf("passed socket should be served by helper process, output:\n%s", out.String())
+		}
+	}
+
+	if err = cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Wait(); err != nil || !strings.Contains(out.String(), "--- PASS: TestSystemdHelperProcess") {
+		t.Fatalf("helper process should pass, got %v, output:\n%s", err, out.String())
+	}
+}
+
+// 无缝重启测试中被启动的服务进程，重启后的新进程同样执行该测试
+func TestReloadHelperProcess(t *testing.T) {
+	addr := os.Getenv("GIG_TEST_RELOAD_ADDR")
+	if addr == "" {
+		t.Skip("only run as helper process of TestReload")
+	}
+	r := New()
+	r.GET("/pid", func(c *Context) { c.String(http.StatusOK, "%d", os.Getpid()) })
+	if err := r.RunWithContext(context.Background(), ServerConfig{Addr: addr, Reload: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err = New().RunWithContext(context.Background(), ServerConfig{Listener: ln, Reload: true}); err == nil {
+		t.Fatal("reload with a custom listener should fail")
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("reload is not supported on windows")
+	}
+	addr := freeAddr(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestReloadHelperProcess$")
+	cmd.Env = append(os.Environ(), "GIG_TEST_RELOAD_ADDR="+addr)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+
+	pid := func() string {
+		resp, err := http.Get("http://" + addr + "/pid")
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	waitPid := func(check func(string) bool) string {
+		for i := 0; i < 500; i++ {
+			if p := pid(); check(p) {
+				return p
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("timeout waiting for server")
+		return ""
+	}
+
+	oldPid := waitPid(func(p string) bool { return p != "" })
+	if oldPid != strconv.Itoa(cmd.Process.Pid) {
+		t.Fatalf("server should run in helper process %d, got %s", cmd.Process.Pid, oldPid)
+	}
+	if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新进程接管 socket，旧进程优雅关闭后退出
+	newPid := waitPid(func(p string) bool { return p != "" && p != oldPid })
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("old process should exit normally, got %v", err)
+	}
+	if p := pid(); p != newPid {
+		t.Fatalf("new process should keep serving, got %q", p)
+	}
+
+	child, _ := strconv.Atoi(newPid)
+	if process, err := os.FindProcess(child); err == nil {
+		_ = process.Signal(syscall.SIGTERM)
+	}
+}
+
+func TestContextCopy(t *testing.T) {
+	r := New()
+	copies := make(chan *Context, 2)
+	r.GET("/users/:id", func(c *Context) {
+		c.Set("user", c.Param("id"))
+		copies <- c.Copy()
+		c.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// 请求结束后 Context 被复用，副本中的数据保持不变
+	for _, id := range []string{"1", "2"} {
+		cp := <-copies
+		if cp.Param("id") != id || cp.GetString("user") != id || cp.FullPath() != "/users/:id" {
+			t.Fatalf("copy should keep params and keys of request %s, got %s %s", id, cp.Param("id"), cp.GetString("user"))
+		}
+		if !cp.IsAborted() {
+			t.Fatal("copy should not continue the handler chain")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package gig
+
+import (
+	"strings"
+)
+
+// 按 Host 划分的路由，如 api.example.com、{tenant}.example.com
+type hostRouter struct {
+	host   string   // 注册时的 host
+	labels []string // host 按 . 切分后的各部分，{name} 表示参数
+	params uint16   // host 中的参数个数
+	router *router  // 该 host 下的路由
+}
+
+// Host 创建只匹配指定 Host 请求头的路由分组
+// host 中 {name} 匹配任意一段，如 {tenant}.example.com，可以通过 Context.Param("tenant") 获取
+// 精确匹配的 host 优先于带参数的 host，都不匹配时使用默认路由
+func (engine *Engine) Host(host string) *RouterGroup {
+	engine.updateRoutes(func(t *routeTable) {
+		t.addHost(host)
+	})
+	return &RouterGroup{
+		host:   strings.ToLower(host),
+		parent: engine.RouterGroup,
+		engine: engine,
+	}
+}
+
+// 获取 host 对应的路由，不存在则新建
+func (r *router) hostRouter(host string) *hostRouter {
+	host = strings.ToLower(host)
+	for _, h := range r.hosts {
+		if h.host == host {
+			return h
+		}
+	}
+
+	h := &hostRouter{host: host, labels: strings.Split(host, "."), router: newRouter()}
+	for _, label := range h.labels {
+		if label == "" {
+			panic("invalid host '" + host + "'")
+		}
+		if label[0] == '{' {
+			if len(label) < 3 || label[len(label)-1] != '}' {
+				panic("invalid host param '" + label + "' in host '" + host + "'")
+			}
+			h.params++
+		}
+	}
+
+	// 精确匹配的 host 排在带参数的 host 之前
+	i := len(r.hosts)
+	if h.params == 0 {
+		for i > 0 && r.hosts[i-1].params > 0 {
+			i--
+		}
+	}
+	r.hosts = append(r.hosts, nil)
+	copy(r.hosts[i+1:], r.hosts[i:])
+	r.hosts[i] = h
+	return h
+}
+
+// 新增指定 host 下的路由，host 为空时添加到默认路由
+func (r *router) addHostRoute(host, method, pattern string, handlers []HandlerFunc) *node {
+	if host == "" {
+		return r.addRoute(method, pattern, handlers)
+	}
+
+	h := r.hostRouter(host)
+	n := h.router.addRoute(method, pattern, handlers)
+	if paramsCount := h.router.maxParams + h.params; paramsCount > r.maxParams {
+		r.maxParams = paramsCount
+	}
+	return n
+}
+
+// 根据请求的 host 选择路由，host 中的参数追加到 params
+func (r *router) matchHost(host string, params *Params) *router {
+	// 去掉端口，如 api.example.com:8080
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+		host = host[:i]
+	}
+	for _, h := range r.hosts {
+		if h.match(host, params) {
+			return h.router
+		}
+	}
+	return r
+}
+
+// 匹配 host，不区分大小写
+func (h *hostRouter) match(host string, params *Params) bool {
+	size := len(*params)
+	for i, label := range h.labels {
+		end := strings.IndexByte(host, '.')
+		if i == len(h.labels)-1 {
+			if end >= 0 {
+				end = -1
+			} else {
+				end = len(host)
+			}
+		}
+		if end <= 0 {
+			*params = (*params)[:size]
+			return false
+		}
+
+		part := host[:end]
+		if label[0] == '{' {
+			*params = append(*params, Param{Key: label[1 : len(label)-1], Value: part})
+		} else if !strings.EqualFold(part, label) {
+			*params = (*params)[:size]
+			return false
+		}
+		if end < len(host) {
+			host = host[end+1:]
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package gig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd socket activation 传入的第一个文件描述符，见 sd_listen_fds(3)
+const systemdFdStart = 3
+
+// RunListener 在指定的 listener 上运行http server，收到 SIGINT 或 SIGTERM 时优雅关闭
+func (engine *Engine) RunListener(ln net.Listener) error {
+	return engine.RunWithContext(context.Background(), ServerConfig{Listener: ln})
+}
+
+// RunUnix 在 unix domain socket 上运行http server，mode 为 socket 文件的权限，如 0660
+// 残留的 socket 文件会被删除，socket 仍在被其他进程监听时返回错误，服务关闭后删除 socket 文件
+func (engine *Engine) RunUnix(file string, mode os.FileMode) error {
+	ln, err := listenUnix(file, mode)
+	if err != nil {
+		return err
+	}
+	return engine.RunListener(ln)
+}
+
+// RunFd 在已打开的文件描述符上运行http server，如父进程传入的 socket
+func (engine *Engine) RunFd(fd int) error {
+	ln, err := fileListener(uintptr(fd), "fd@"+strconv.Itoa(fd))
+	if err != nil {
+		return err
+	}
+	return engine.RunListener(ln)
+}
+
+// RunSystemd 在 systemd socket activation 传入的第一个 socket 上运行http server
+// 传入多个 socket 时可以通过 SystemdListeners 获取全部 listener
+func (engine *Engine) RunSystemd() error {
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		return errors.New("no sockets passed by systemd socket activation")
+	}
+	for _, ln := range listeners[1:] {
+		_ = ln.Close()
+	}
+	return engine.RunListener(listeners[0])
+}
+
+// SystemdListeners 获取 systemd socket activation 传入的 listener，不是由 systemd 启动时返回 nil
+// 获取后清除 LISTEN_PID、LISTEN_FDS 和 LISTEN_FDNAMES 环境变量，避免被子进程继承
+func SystemdListeners() ([]net.Listener, error) {
+	listeners, _, err := systemdListeners()
+	return listeners, err
+}
+
+// 获取 systemd socket activation 传入的 listener 及其在 LISTEN_FDNAMES 中的名称，
+// 未命名的 socket 名称为 LISTEN_FD_<fd>
+func systemdListeners() ([]net.Listener, []string, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil, nil
+	}
+	fdNames := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdFdStart+i)
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		ln, err := fileListener(uintptr(systemdFdStart+i), name)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, nil, err
+		}
+		listeners = append(listeners, ln)
+		names = append(names, name)
+	}
+	return listeners, names, nil
+}
+
+// 根据文件描述符创建 listener，原文件描述符会被关闭
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// 监听 unix domain socket 并设置文件权限
+func listenUnix(file string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(file); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", file)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err = os.Chmod(file, mode); err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// 删除残留的 unix socket 文件，如进程异常退出后留下的文件
+// 文件不是 socket 或仍在被监听时返回错误
+func removeStaleSocket(file string) error {
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a unix socket", file)
+	}
+	if conn, err := net.DialTimeout("unix", file, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket %s is already in use", file)
+	}
+	return os.Remove(file)
+}
@@ -52,6 +52,9 @@ type LogFormatterParams struct {
 	Method string
 	// Path is a path the client requests.
 	Path string
+	// FullPath is the matched route pattern, such as /users/:id.
+	// It is empty if no route was matched.
+	FullPath string
 	// ErrorMessage is set if error has occurred in processing the request.
 	ErrorMessage string
 	// isTerm shows whether does gin's output descriptor refers to a terminal.
@@ -252,6 +255,7 @@ func LoggerWithConfig(conf LoggerConfig) HandlerFunc {
 			}
 
 			param.Path = path
+			param.FullPath = c.FullPath()
 
 			fmt.Fprint(out, formatter(param))
 		}
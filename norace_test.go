@@ -0,0 +1,5 @@
+//go:build !race
+
+package gig
+
+const raceEnabled = false
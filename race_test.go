@@ -0,0 +1,6 @@
+//go:build race
+
+package gig
+
+// 开启 race 检测时 sync.Pool 会随机丢弃对象，不检查内存分配次数
+const raceEnabled = true
@@ -0,0 +1,80 @@
+package gig
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 无缝重启时传给新进程的环境变量
+const (
+	envListenFds = "GIG_LISTEN_FDS" // 传入的 listener 个数，从文件描述符 3 开始
+	envReadyFd   = "GIG_READY_FD"   // 就绪后写入并关闭的管道文件描述符
+)
+
+// 等待新进程就绪的默认时间
+const defaultReloadTimeout = 30 * time.Second
+
+// RunGraceful 运行支持无缝重启的http server，收到 SIGHUP 或 SIGUSR2 时启动新的可执行文件
+// 并传入正在监听的 socket，新进程就绪后当前进程处理完进行中的请求后返回
+func (engine *Engine) RunGraceful(addr string) error {
+	return engine.RunWithContext(context.Background(), ServerConfig{Addr: addr, Reload: true})
+}
+
+// 获取旧进程传入的 listener，不是由旧进程启动时返回 nil
+func inheritedListeners() ([]net.Listener, error) {
+	count, err := strconv.Atoi(os.Getenv(envListenFds))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	_ = os.Unsetenv(envListenFds)
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		fd := systemdFdStart + i
+		ln, err := fileListener(uintptr(fd), "inherited@"+strconv.Itoa(fd))
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// 通知旧进程当前进程已就绪
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFd))
+	if err != nil {
+		return
+	}
+	_ = os.Unsetenv(envReadyFd)
+
+	if f := os.NewFile(uintptr(fd), "ready"); f != nil {
+		_, _ = f.Write([]byte{1})
+		_ = f.Close()
+	}
+}
+
+// 新进程的环境变量，去掉继承自当前进程的无缝重启变量
+func reloadEnv(listeners int) []string {
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !hasEnvKey(kv, envListenFds) && !hasEnvKey(kv, envReadyFd) {
+			env = append(env, kv)
+		}
+	}
+	return append(env,
+		envListenFds+"="+strconv.Itoa(listeners),
+		envReadyFd+"="+strconv.Itoa(systemdFdStart+listeners),
+	)
+}
+
+// 环境变量 kv 的名称是否为 key
+func hasEnvKey(kv, key string) bool {
+	return len(kv) > len(key) && kv[:len(key)] == key && kv[len(key)] == '='
+}
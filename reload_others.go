@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package gig
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"time"
+)
+
+// 无缝重启依赖 SIGHUP 和传递文件描述符，仅支持 unix 系统
+func watchReload(listeners []net.Listener, timeout time.Duration, shutdown func()) (func(), error) {
+	return nil, errors.New("reload is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,109 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package gig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 收到 SIGHUP 或 SIGUSR2 时启动新进程，新进程就绪后调用 shutdown 优雅关闭当前进程
+// 新进程启动失败时当前进程继续运行，返回的 stop 用于停止监听信号
+func watchReload(listeners []net.Listener, timeout time.Duration, shutdown func()) (func(), error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGUSR2)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case s := <-sig:
+				debugPrint("Received %s, starting new process", s)
+				if err := startProcess(listeners, timeout); err != nil {
+					debugPrint("[WARNING] reload failed, keep running: %v", err)
+					continue
+				}
+				debugPrint("New process is ready, shutting down")
+				shutdown()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}, nil
+}
+
+// 启动当前可执行文件的新进程，传入 listeners 并等待其就绪
+// 新进程中 listeners 依次为文件描述符 3、4...，之后是用于通知就绪的管道
+func startProcess(listeners []net.Listener, timeout time.Duration) error {
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, ln := range listeners {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %T can not be passed to new process", ln)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	path, err := os.Executable()
+	if err != nil {
+		_ = readyW.Close()
+		return err
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = reloadEnv(len(listeners))
+	cmd.ExtraFiles = append(files, readyW)
+	err = cmd.Start()
+	// 关闭当前进程持有的写端，新进程退出时读端才能读到 EOF
+	_ = readyW.Close()
+	if err != nil {
+		return err
+	}
+
+	if timeout <= 0 {
+		timeout = defaultReloadTimeout
+	}
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = errors.New("timeout")
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("new process %d is not ready: %w", cmd.Process.Pid, err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,131 @@
+package gig
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 资源控制器接口，控制器实现其中任意几个即可，Resource 只注册已实现的动作
+type (
+	// GET /photos 资源列表
+	ResourceIndex interface {
+		Index(c *Context)
+	}
+	// GET /photos/new 新建资源的表单
+	ResourceNew interface {
+		New(c *Context)
+	}
+	// POST /photos 新建资源
+	ResourceCreate interface {
+		Create(c *Context)
+	}
+	// GET /photos/:id 资源详情
+	ResourceShow interface {
+		Show(c *Context)
+	}
+	// GET /photos/:id/edit 编辑资源的表单
+	ResourceEdit interface {
+		Edit(c *Context)
+	}
+	// PUT、PATCH /photos/:id 更新资源
+	ResourceUpdate interface {
+		Update(c *Context)
+	}
+	// DELETE /photos/:id 删除资源
+	ResourceDestroy interface {
+		Destroy(c *Context)
+	}
+)
+
+// Resource 按 RESTful 约定为控制器注册路由，如 Resource("/photos", PhotoController{}) 注册：
+//
+//	GET    /photos          Index
+//	GET    /photos/new      New
+//	POST   /photos          Create
+//	GET    /photos/:id      Show
+//	GET    /photos/:id/edit Edit
+//	PUT    /photos/:id      Update
+//	PATCH  /photos/:id      Update
+//	DELETE /photos/:id      Destroy
+//
+// handlers 作为这些路由的路由级中间件。返回的分组前缀为 /photos/:id，用于注册嵌套资源，
+// 分组前缀中已有 :id 时嵌套资源的参数名为单数形式加 _id，避免与父资源的参数同名：
+//
+//	photos := engine.Resource("/photos", PhotoController{})
+//	photos.Resource("/comments", CommentController{}) // GET /photos/:id/comments/:comment_id ...
+func (group *RouterGroup) Resource(relativePath string, controller interface{}, handlers ...HandlerFunc) *RouterGroup {
+	relativePath = strings.TrimSuffix(relativePath, "/")
+	if relativePath == "" {
+		panic("resource path can not be empty")
+	}
+	param := "id"
+	if hasParam(group.prefix, param) {
+		param = resourceParam(relativePath)
+	}
+	member := relativePath + "/:" + param
+
+	registered := false
+	add := func(method, pattern, action string, handler HandlerFunc) {
+		chain := make([]HandlerFunc, 0, len(handlers)+1)
+		chain = append(append(chain, handlers...), handler)
+		route := group.newRoute(method, pattern, chain)
+		route.routerType = routerTypeRESTFul
+		route.handlerName = fmt.Sprintf("%T.%s", controller, action)
+		group.register(route)
+		registered = true
+	}
+	if c, ok := controller.(ResourceIndex); ok {
+		add(http.MethodGet, relativePath, "Index", c.Index)
+	}
+	if c, ok := controller.(ResourceNew); ok {
+		add(http.MethodGet, relativePath+"/new", "New", c.New)
+	}
+	if c, ok := controller.(ResourceCreate); ok {
+		add(http.MethodPost, relativePath, "Create", c.Create)
+	}
+	if c, ok := controller.(ResourceShow); ok {
+		add(http.MethodGet, member, "Show", c.Show)
+	}
+	if c, ok := controller.(ResourceEdit); ok {
+		add(http.MethodGet, member+"/edit", "Edit", c.Edit)
+	}
+	if c, ok := controller.(ResourceUpdate); ok {
+		add(http.MethodPut, member, "Update", c.Update)
+		add(http.MethodPatch, member, "Update", c.Update)
+	}
+	if c, ok := controller.(ResourceDestroy); ok {
+		add(http.MethodDelete, member, "Destroy", c.Destroy)
+	}
+	if !registered {
+		panic(fmt.Sprintf("resource controller %T for path '%s' implements no actions", controller, relativePath))
+	}
+
+	return group.Group(member)
+}
+
+// pattern 中是否有名为 key 的参数
+func hasParam(pattern, key string) bool {
+	for i := findWildcard(pattern, 0); i >= 0 && pattern[i] == ':'; i = findWildcard(pattern, i) {
+		end := paramEnd(pattern, i)
+		if k, _ := parseParam(pattern[i:end]); k == key {
+			return true
+		}
+		i = end
+	}
+	return false
+}
+
+// 嵌套资源的参数名，取资源路径最后一段的单数形式加 _id，如 /photos 为 photo_id，/categories 为 category_id
+func resourceParam(relativePath string) string {
+	name := relativePath[strings.LastIndexByte(relativePath, '/')+1:]
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		name = name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "ses"), strings.HasSuffix(name, "xes"):
+		name = name[:len(name)-2]
+	case strings.HasSuffix(name, "s"):
+		name = name[:len(name)-1]
+	}
+	return name + "_id"
+}
@@ -0,0 +1,195 @@
+package gig
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// 路由信息，注册路由时返回
+type Route struct {
+	Method string // 请求方式
+	Path   string // 完整路由，包括分组前缀
+
+	host        string        // 路由所属的 Host
+	handlers    []HandlerFunc // 合并分组中间件后的处理链
+	engine      *Engine
+	routerType  int          // 路由类型，如 routerTypeGig、routerTypeRESTFul、routerTypeHandler
+	handlerName string       // 业务处理方法名称
+	meta        atomic.Value // 路由元数据 map[string]interface{}，修改时整体替换
+}
+
+// Name 设置路由名称，用于 URLFor 反向生成URL
+// 同一名称只能对应一个路由，不同请求方式的相同路由可以使用相同名称
+func (r *Route) Name(name string) *Route {
+	r.engine.updateRoutes(func(t *routeTable) {
+		t.router.addName(name, r.host, r.Path)
+	})
+	return r
+}
+
+// SetMeta 设置路由元数据，如所需权限、限流级别、接口说明、超时时间等
+// 中间件中通过 c.Route().Meta(key) 读取，服务运行时设置同样是安全的：
+//
+//	engine.GET("/admin/users", listUsers).SetMeta("scope", "admin").SetMeta("timeout", 3*time.Second)
+func (r *Route) SetMeta(key string, value interface{}) *Route {
+	r.engine.mu.Lock()
+	defer r.engine.mu.Unlock()
+
+	old, _ := r.meta.Load().(map[string]interface{})
+	meta := make(map[string]interface{}, len(old)+1)
+	for k, v := range old {
+		meta[k] = v
+	}
+	meta[key] = value
+	r.meta.Store(meta)
+	return r
+}
+
+// Meta 获取路由元数据，不存在时返回 nil
+func (r *Route) Meta(key string) interface{} {
+	meta, _ := r.meta.Load().(map[string]interface{})
+	return meta[key]
+}
+
+// MetaString 获取字符串类型的路由元数据，不存在或类型不符时返回空字符串
+func (r *Route) MetaString(key string) string {
+	value, _ := r.Meta(key).(string)
+	return value
+}
+
+// 路由表信息，用于打印路由表、生成文档和测试
+type RouteInfo struct {
+	Method      string // 请求方式
+	Path        string // 完整路由
+	Handler     string // 业务处理方法名称，即处理链中的最后一个方法
+	Middlewares int    // 中间件个数，包括全局、分组和路由级中间件
+	Name        string // 路由名称，未设置时为空
+	Host        string // 路由所属的 Host，默认路由为空
+}
+
+// Routes 获取全部路由，默认路由在前，之后依次为各个 Host 的路由，按请求方式和路由排序
+func (engine *Engine) Routes() []RouteInfo {
+	r := engine.getRouter()
+	names := make(map[routeName]string, len(r.names))
+	for name, rn := range r.names {
+		names[rn] = name
+	}
+
+	routes := r.routesInfo("", names, make([]RouteInfo, 0))
+	for _, h := range r.hosts {
+		routes = h.router.routesInfo(h.host, names, routes)
+	}
+	return routes
+}
+
+// 把路由表信息追加到 routes
+func (r *router) routesInfo(host string, names map[routeName]string, routes []RouteInfo) []RouteInfo {
+	methods := make([]string, 0, len(r.roots))
+	for method := range r.roots {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		nodes := r.getRoutes(method)
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].pattern < nodes[j].pattern
+		})
+		for _, n := range nodes {
+			routes = append(routes, RouteInfo{
+				Method:      method,
+				Path:        n.pattern,
+				Handler:     n.handlerName(),
+				Middlewares: len(n.handlers) - 1,
+				Name:        names[routeName{host, n.pattern}],
+				Host:        host,
+			})
+		}
+	}
+	return routes
+}
+
+// 业务处理方法名称，挂载的 http.Handler 返回其类型名称
+func (n *node) handlerName() string {
+	if n.route != nil {
+		return n.route.handlerName
+	}
+	return nameOfFunction(n.handlers[len(n.handlers)-1])
+}
+
+// 获取方法名称，如 github.com/izuojian/gig.Logger.func1
+func nameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
+
+// URLFor 根据路由名称生成URL
+// params 为 key/value 形式，如 URLFor("user.show", "id", 1)，
+// 依次填充路由中的 :参数 和 *通配符，多余的参数作为 query 参数；Host 下的路由只生成路径部分
+func (engine *Engine) URLFor(name string, params ...interface{}) (string, error) {
+	rn, ok := engine.getRouter().names[name]
+	if !ok {
+		return "", errors.New("route " + name + " not found")
+	}
+	if len(params)%2 != 0 {
+		return "", errors.New("params of route " + name + " must be key/value pairs")
+	}
+	pattern := rn.pattern
+
+	values := make(map[string]string, len(params)/2)
+	keys := make([]string, 0, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key := fmt.Sprint(params[i])
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	var b strings.Builder
+	i := 0
+	for start := findWildcard(pattern, 0); start >= 0; start = findWildcard(pattern, i) {
+		b.WriteString(pattern[i:start])
+
+		var key string
+		if pattern[start] == '*' {
+			key, i = pattern[start+1:], len(pattern)
+		} else {
+			i = paramEnd(pattern, start)
+			key, _ = parseParam(pattern[start:i])
+		}
+		value, ok := values[key]
+		if !ok || value == "" {
+			return "", errors.New("missing param " + key + " for route " + name)
+		}
+		delete(values, key)
+
+		if pattern[start] == '*' {
+			// 通配符中的 / 保持原样，其余部分逐段转义
+			segments := strings.Split(value, "/")
+			for j, segment := range segments {
+				segments[j] = url.PathEscape(segment)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+	}
+	b.WriteString(pattern[i:])
+
+	if len(values) > 0 {
+		query := make(url.Values, len(values))
+		for _, key := range keys {
+			if value, ok := values[key]; ok {
+				query.Set(key, value)
+			}
+		}
+		b.WriteString("?" + query.Encode())
+	}
+	return b.String(), nil
+}
@@ -1,22 +1,42 @@
 package gig
 
 import (
+	"github.com/izuojian/gig/internal/utils"
 	"net/http"
+	"net/url"
+	"path"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // roots key eg, roots['GET'] roots['POST']
-// handlers key eg, handlers['GET-/p/:lang/doc'], handlers['POST-/p/book']
 type router struct {
-	// 使用 roots 来存储每种请求方式的 Trie 树根节点
+	// 使用 roots 来存储每种请求方式的 Radix 树根节点，HandlerFunc 保存在路由终点节点上
 	roots map[string]*node
-	// 使用 handlers 存储每种请求方式的 HandlerFunc
-	handlers map[string]HandlerFunc
+	// 所有路由中参数个数的最大值，用于预分配参数切片
+	maxParams uint16
+	// 参数切片对象池，避免每次请求都分配内存
+	paramsPool sync.Pool
+	// 路由名称与路由的映射，用于 URLFor
+	names map[string]routeName
+	// 按 Host 划分的路由
+	hosts []*hostRouter
+	// 合并全局中间件后的 404、405 和 OPTIONS 自动响应处理链，只在发布的 router 上设置
+	noRoute, noMethod, options []HandlerFunc
 }
 
 // 支持的Methods
 var (
-	// HTTPMETHOD list the supported http methods.
+	// anyMethods ANY 和 Mount 注册的标准请求方式，自定义请求方式见 routeTable.methods
+	anyMethods = []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodHead, http.MethodOptions, http.MethodDelete,
+		http.MethodConnect, http.MethodTrace,
+	}
+
+	// HTTPMETHOD list the standard http methods.
+	// Handle also accepts custom methods such as PROPFIND and MKCOL.
 	HTTPMETHODS = map[string]bool{
 		"GET":     true,
 		"POST":    true,
@@ -25,10 +45,33 @@ var (
 		"PATCH":   true,
 		"OPTIONS": true,
 		"HEAD":    true,
+		"CONNECT": true,
+		"TRACE":   true,
 	}
 )
 
+// methodAny 表示 ANY 注册的路由，匹配所有标准请求方式和已注册的自定义请求方式
+const methodAny = "ANY"
+
+// 请求方式是否为合法的 token，见 RFC 7230 3.1.1 和 3.2.6
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if isLetter(c) || isDigit(c) {
+			continue
+		}
+		if strings.IndexByte("!#$%&'*+-.^_`|~", c) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // router type
+// routerTypeGig 为普通路由，routerTypeRESTFul 为 Resource 注册的资源路由，routerTypeHandler 为挂载的 http.Handler
 const (
 	routerTypeGig = iota
 	routerTypeRESTFul
@@ -36,60 +79,92 @@ const (
 )
 
 func newRouter() *router {
-	return &router{
-		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+	r := &router{
+		roots: make(map[string]*node),
+		names: make(map[string]routeName),
 	}
+	r.paramsPool.New = func() interface{} {
+		ps := make(Params, 0, r.maxParams)
+		return &ps
+	}
+	return r
 }
 
-// 新增路由
-func (r *router) addRoute(method, pattern string, handler HandlerFunc) {
-	parts := _parsePattern(pattern)
-
-	key := method + "-" + pattern
+// 新增路由，返回路由终点节点
+func (r *router) addRoute(method, pattern string, handlers []HandlerFunc) *node {
 	// 根节点不存在则新建
 	if _, ok := r.roots[method]; !ok {
 		r.roots[method] = &node{}
 	}
 	// 新增节点
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	pattern = _cleanPattern(pattern)
+	n := r.roots[method].insert(pattern, handlers)
+
+	if paramsCount := countParams(pattern); paramsCount > r.maxParams {
+		r.maxParams = paramsCount
+	}
+	return n
+}
+
+// 路由名称对应的路由，不同 Host 下的相同路由是不同的路由
+type routeName struct {
+	host, pattern string
 }
 
-// 获取路由
-func (r *router) getRoute(method, urlPath string) (*node, map[string]string) {
-	searchParts := _parsePattern(urlPath)
-	params := make(map[string]string)
+// 新增路由名称，同一名称对应不同路由时panic
+func (r *router) addName(name, host, pattern string) {
+	if existing, ok := r.names[name]; ok && existing != (routeName{host, pattern}) {
+		panic("route name '" + name + "' is already used by path '" + existing.host + existing.pattern + "'")
+	}
+	r.names[name] = routeName{host, pattern}
+}
+
+// 获取路由，匹配到的参数追加到 params
+func (r *router) getRoute(method, urlPath string, params *Params) *node {
 	root, ok := r.roots[method]
 	if !ok {
-		return nil, nil
-	}
-
-	n := root.search(searchParts, 0)
-	if n != nil {
-		parts := _parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				// 兼容 :id.html 这样的路由
-				if paramPointIndex := strings.Index(part, "."); paramPointIndex != -1 {
-					if valuePointIndex := strings.Index(searchParts[index], "."); valuePointIndex != -1 {
-						params[part[1:paramPointIndex]] = searchParts[index][:valuePointIndex]
-					} else {
-						params[part[1:paramPointIndex]] = searchParts[index]
-					}
-				} else {
-					params[part[1:]] = searchParts[index]
-				}
-			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
-				break
-			}
-		}
-		return n, params
+		return nil
 	}
+	return root.search(urlPath, params)
+}
 
-	return nil, nil
+// 查找去掉或补上末尾 / 后能匹配的路径，用于 RedirectTrailingSlash
+func (r *router) trailingSlashPath(method, urlPath string, params *Params) (string, bool) {
+	if urlPath == "/" {
+		return "", false
+	}
+	fixedPath := urlPath + "/"
+	if strings.HasSuffix(urlPath, "/") {
+		fixedPath = urlPath[:len(urlPath)-1]
+	}
+	*params = (*params)[:0]
+	found := r.getRoute(method, fixedPath, params) != nil
+	*params = (*params)[:0]
+	return fixedPath, found
+}
+
+// 查找规范化并修正大小写后能匹配的路径，用于 RedirectFixedPath
+func (r *router) fixedPath(method, urlPath string, fixTrailingSlash bool) (string, bool) {
+	root, ok := r.roots[method]
+	if !ok {
+		return "", false
+	}
+
+	cleaned := _cleanPath(urlPath)
+	if fixed, ok := root.searchCaseInsensitive(cleaned, make([]byte, 0, len(cleaned)+1)); ok {
+		return string(fixed), true
+	}
+	if fixTrailingSlash && cleaned != "/" {
+		if strings.HasSuffix(cleaned, "/") {
+			cleaned = cleaned[:len(cleaned)-1]
+		} else {
+			cleaned += "/"
+		}
+		if fixed, ok := root.searchCaseInsensitive(cleaned, make([]byte, 0, len(cleaned))); ok {
+			return string(fixed), true
+		}
+	}
+	return "", false
 }
 
 // 获取全部路由
@@ -104,27 +179,147 @@ func (r *router) getRoutes(method string) []*node {
 	return nodes
 }
 
+// 从对象池获取参数切片
+func (r *router) getParams() *Params {
+	ps := r.paramsPool.Get().(*Params)
+	if cap(*ps) < int(r.maxParams) {
+		*ps = make(Params, 0, r.maxParams)
+	}
+	*ps = (*ps)[:0]
+	return ps
+}
+
+// 参数切片放回对象池
+func (r *router) putParams(ps *Params) {
+	r.paramsPool.Put(ps)
+}
+
 // 执行
 func (r *router) handle(c *Context) {
+	engine := c.engine
 	httpMethod := c.Request.Method
 	rPath := c.Request.URL.Path
-	routerNode, params := r.getRoute(httpMethod, rPath)
-	if routerNode != nil {
-		c.Params = params
+	unescape := false
+	if engine.UseRawPath && len(c.Request.URL.RawPath) > 0 {
+		// 使用转义后的路径匹配，参数中的 %2F 不会被当作路由段分隔符
+		rPath = c.Request.URL.RawPath
+		unescape = engine.UnescapePathValues
+	}
+	params := r.getParams()
+	defer r.putParams(params)
 
-		key := httpMethod + "-" + routerNode.pattern
+	// 按 Host 选择路由，之后的查找都在选中的路由中进行，404、405 和 OPTIONS 处理链仍使用发布的 router 上的
+	published := r
+	if len(r.hosts) > 0 {
+		r = r.matchHost(c.Request.Host, params)
+	}
 
-		// 把匹配的HandleFunc添加到中间的handlers中
-		// 由 Next() 统一执行
-		c.handlers = append(c.handlers, r.handlers[key])
+	if routerNode := r.getRoute(httpMethod, rPath, params); routerNode != nil {
+		if unescape {
+			unescapeParams(*params)
+		}
+		// 参数复制到 Context 自己的切片中，params 在请求结束前就会被回收
+		c.Params = append(c.Params[:0], *params...)
+		c.route = routerNode.route
+
+		// 路由处理链已包含所有分组中间件，由 Next() 统一执行
+		c.handlers = routerNode.handlers
+		c.Next()
+		return
+	}
+
+	if httpMethod != http.MethodConnect && rPath != "/" {
+		// 末尾 / 不一致，跳转到已注册的路由
+		if engine.RedirectTrailingSlash {
+			if fixedPath, ok := r.trailingSlashPath(httpMethod, rPath, params); ok {
+				redirectRequest(c, fixedPath)
+				return
+			}
+		}
+		// 路径不规范或大小写不一致，跳转到修正后的路由
+		if engine.RedirectFixedPath {
+			if fixedPath, ok := r.fixedPath(httpMethod, rPath, engine.RedirectTrailingSlash); ok {
+				redirectRequest(c, fixedPath)
+				return
+			}
+		}
+	}
+
+	if httpMethod == http.MethodOptions && engine.HandleOPTIONS && r.setAllowHeader(c, rPath, params) {
+		// 自动响应 OPTIONS 请求
+		c.handlers = published.options
+	} else if engine.HandleMethodNotAllowed && r.setAllowHeader(c, rPath, params) {
+		// 路由存在但请求方式不匹配，响应 405
+		c.handlers = published.noMethod
 	} else {
-		c.handlers = append(c.handlers, func(ctx *Context) {
-			c.String(http.StatusNotFound, "404 NOT FOUND: %s \n", rPath)
-		})
+		// 未匹配的路由只执行全局中间件和 404 处理链
+		c.handlers = published.noRoute
 	}
 	c.Next()
 }
 
+// 跳转到修正后的路径，GET 请求使用 301，其他请求使用 308 以保留请求方式和请求体
+func redirectRequest(c *Context, fixedPath string) {
+	code := http.StatusPermanentRedirect
+	if c.Request.Method == http.MethodGet {
+		code = http.StatusMovedPermanently
+	}
+	// 挂载的 *Engine 中跳转到包含挂载前缀的完整路径
+	fixedPath = mountPrefix(c.Request) + fixedPath
+	if c.Request.URL.RawQuery != "" {
+		fixedPath += "?" + c.Request.URL.RawQuery
+	}
+	debugPrint("redirecting request %d: %s --> %s", code, c.Request.URL.Path, fixedPath)
+	c.Redirect(code, fixedPath)
+}
+
+// 对参数值进行 URL 解码，解码失败时保留原值
+func unescapeParams(params Params) {
+	for i := range params {
+		if strings.IndexByte(params[i].Value, '%') < 0 {
+			continue
+		}
+		if value, err := url.PathUnescape(params[i].Value); err == nil {
+			params[i].Value = value
+		}
+	}
+}
+
+// 查找当前请求路径允许的请求方式并写入 Allow 响应头，没有允许的请求方式时返回 false
+func (r *router) setAllowHeader(c *Context, urlPath string, params *Params) bool {
+	allow := r.allowed(c.engine, c.Request.Method, urlPath, params)
+	if allow == "" {
+		return false
+	}
+	c.Header("Allow", allow)
+	return true
+}
+
+// 查找 urlPath 允许的其他请求方式，用于 Allow 响应头，urlPath 为 * 时返回所有请求方式
+// 开启 HandleOPTIONS 时结果中总是包含 OPTIONS
+func (r *router) allowed(engine *Engine, reqMethod, urlPath string, params *Params) string {
+	allowed := make([]string, 0, len(r.roots)+1)
+	for method := range r.roots {
+		if method == reqMethod {
+			continue
+		}
+		*params = (*params)[:0]
+		if urlPath == "*" || r.getRoute(method, urlPath, params) != nil {
+			allowed = append(allowed, method)
+		}
+	}
+	*params = (*params)[:0]
+	if len(allowed) == 0 {
+		return ""
+	}
+
+	if engine.HandleOPTIONS && !utils.InSlice(http.MethodOptions, allowed) {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
+}
+
 // 解析路由pattern，获取所有路由段segment
 // 注意：pattern 只允许存在一个通配符*
 func _parsePattern(pattern string) []string {
@@ -142,3 +337,35 @@ func _parsePattern(pattern string) []string {
 	}
 	return parts
 }
+
+// 规范化注册的路由，去掉空的路由段，保留末尾的 /
+// 如 //users///:id/ 规范化为 /users/:id/
+// 不截断通配符之后的部分，/x/*a/b 这样不合法的路由在插入时 panic
+func _cleanPattern(pattern string) string {
+	parts := make([]string, 0, strings.Count(pattern, "/")+1)
+	for _, item := range strings.Split(pattern, "/") {
+		if item != "" {
+			parts = append(parts, item)
+		}
+	}
+	cleaned := "/" + strings.Join(parts, "/")
+	if len(parts) > 0 && strings.HasSuffix(pattern, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// 规范化请求路径，处理 . 和 .. 以及重复的 /，保留末尾的 /
+func _cleanPath(urlPath string) string {
+	if urlPath == "" {
+		return "/"
+	}
+	if urlPath[0] != '/' {
+		urlPath = "/" + urlPath
+	}
+	cleaned := path.Clean(urlPath)
+	if cleaned != "/" && strings.HasSuffix(urlPath, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
@@ -16,6 +16,13 @@ func newTestRouter() *router {
 	return r
 }
 
+// 查找路由并返回匹配到的参数
+func getRoute(r *router, method, path string) (*node, Params) {
+	ps := make(Params, 0, r.maxParams)
+	n := r.getRoute(method, path, &ps)
+	return n, ps
+}
+
 func TestParsePattern(t *testing.T) {
 	ok := reflect.DeepEqual(_parsePattern("/p/:name"), []string{"p", ":name"})
 	ok = ok && reflect.DeepEqual(_parsePattern("/p/*"), []string{"p", "*"})
@@ -27,7 +34,7 @@ func TestParsePattern(t *testing.T) {
 
 func TestGetRoute(t *testing.T) {
 	r := newTestRouter()
-	n, ps := r.getRoute("GET", "/hello/geektutu")
+	n, ps := getRoute(r, "GET", "/hello/geektutu")
 
 	if n == nil {
 		t.Fatal("nil shouldn't be returned")
@@ -37,24 +44,24 @@ func TestGetRoute(t *testing.T) {
 		t.Fatal("should match /hello/:name")
 	}
 
-	if ps["name"] != "geektutu" {
+	if ps.ByName("name") != "geektutu" {
 		t.Fatal("name should be equal to 'geektutu'")
 	}
 
-	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps["name"])
+	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps.ByName("name"))
 
 }
 
 func TestGetRoute2(t *testing.T) {
 	r := newTestRouter()
-	n1, ps1 := r.getRoute("GET", "/assets/file1.txt")
-	ok1 := n1.pattern == "/assets/*filepath" && ps1["filepath"] == "file1.txt"
+	n1, ps1 := getRoute(r, "GET", "/assets/file1.txt")
+	ok1 := n1.pattern == "/assets/*filepath" && ps1.ByName("filepath") == "file1.txt"
 	if !ok1 {
 		t.Fatal("pattern shoule be /assets/*filepath & filepath shoule be file1.txt")
 	}
 
-	n2, ps2 := r.getRoute("GET", "/assets/css/test.css")
-	ok2 := n2.pattern == "/assets/*filepath" && ps2["filepath"] == "css/test.css"
+	n2, ps2 := getRoute(r, "GET", "/assets/css/test.css")
+	ok2 := n2.pattern == "/assets/*filepath" && ps2.ByName("filepath") == "css/test.css"
 	if !ok2 {
 		t.Fatal("pattern shoule be /assets/*filepath & filepath shoule be css/test.css")
 	}
@@ -72,3 +79,180 @@ func TestGetRoutes(t *testing.T) {
 		t.Fatal("the number of routes shoule be 4")
 	}
 }
+
+func TestGetRoutePriority(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/users/*path", nil)
+	r.addRoute("GET", "/users/:id", nil)
+	r.addRoute("GET", "/users/new", nil)
+	r.addRoute("GET", "/users/new/edit", nil)
+	r.addRoute("GET", "/users/:id/posts", nil)
+
+	cases := map[string]string{
+		"/users/new":       "/users/new",
+		"/users/1":         "/users/:id",
+		"/users/new/edit":  "/users/new/edit",
+		"/users/new/posts": "/users/:id/posts",
+		"/users/1/a/b":     "/users/*path",
+	}
+	for path, pattern := range cases {
+		n, _ := getRoute(r, "GET", path)
+		if n == nil || n.pattern != pattern {
+			t.Fatalf("%s should match %s, got %v", path, pattern, n)
+		}
+	}
+
+	_, ps := getRoute(r, "GET", "/users/new/posts")
+	if ps.ByName("id") != "new" {
+		t.Fatal("id should be equal to 'new'")
+	}
+}
+
+func TestAddRouteConflict(t *testing.T) {
+	conflicts := [][2]string{
+		{"/a/:x", "/a/:y"},
+		{"/a/*x", "/a/*y"},
+		{"/a/:x", "/a/:x"},
+		{"/a/:x/b", "/a/:y/c"},
+		{"/a//b", "/a/b"},
+	}
+	for _, c := range conflicts {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s and %s should conflict", c[0], c[1])
+				}
+			}()
+			r := newRouter()
+			r.addRoute("GET", c[0], nil)
+			r.addRoute("GET", c[1], nil)
+		}()
+	}
+
+	for _, pattern := range []string{"/x/*a/b", "/x/*a/"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s should panic", pattern)
+				}
+			}()
+			newRouter().addRoute("GET", pattern, nil)
+		}()
+	}
+
+	r := newRouter()
+	r.addRoute("GET", "/a/:x", nil)
+	r.addRoute("POST", "/a/:y", nil)
+	r.addRoute("GET", "/a/:x/b", nil)
+	r.addRoute("GET", "/a/*rest", nil)
+	r.addRoute("GET", "/a/:x/", nil)
+}
+
+func TestGetRouteCompatible(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/p/:id.html", nil)
+	r.addRoute("GET", "/users/:id", nil)
+
+	n, ps := getRoute(r, "GET", "/p/12.html")
+	if n == nil || n.pattern != "/p/:id.html" || ps.ByName("id") != "12" {
+		t.Fatal("/p/12.html should match /p/:id.html with id 12")
+	}
+
+	if n, _ = getRoute(r, "GET", "/users/1/"); n != nil {
+		t.Fatal("/users/1/ should not match /users/:id")
+	}
+}
+
+func TestGetRouteConstraint(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/items/:name", nil)
+	r.addRoute("GET", "/items/:id<int>", nil)
+	r.addRoute("GET", "/items/:uid<uuid>", nil)
+	r.addRoute("GET", "/posts/:slug<[a-z-]+>", nil)
+	r.addRoute("GET", "/posts/:id<int>/comments", nil)
+
+	cases := []struct {
+		path    string
+		pattern string
+		key     string
+		value   string
+	}{
+		{"/items/12", "/items/:id<int>", "id", "12"},
+		{"/items/book", "/items/:name", "name", "book"},
+		{"/items/5f1d3a3e-0b7c-4a43-9d1e-2b6a8f0c9e11", "/items/:uid<uuid>", "uid", "5f1d3a3e-0b7c-4a43-9d1e-2b6a8f0c9e11"},
+		{"/posts/hello-world", "/posts/:slug<[a-z-]+>", "slug", "hello-world"},
+		{"/posts/12/comments", "/posts/:id<int>/comments", "id", "12"},
+	}
+	for _, c := range cases {
+		n, ps := getRoute(r, "GET", c.path)
+		if n == nil || n.pattern != c.pattern || ps.ByName(c.key) != c.value {
+			t.Fatalf("%s should match %s with %s=%s, got %v %v", c.path, c.pattern, c.key, c.value, n, ps)
+		}
+	}
+
+	for _, path := range []string{"/posts/Hello", "/posts/abc/comments"} {
+		if n, _ := getRoute(r, "GET", path); n != nil {
+			t.Fatalf("%s should not be matched, got %v", path, n)
+		}
+	}
+
+	for _, c := range [][2]string{{"/a/:x<int>", "/a/:y<int>"}, {"/a/:x<[0-9+>", "/b"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s and %s should panic", c[0], c[1])
+				}
+			}()
+			r := newRouter()
+			r.addRoute("GET", c[0], nil)
+			r.addRoute("GET", c[1], nil)
+		}()
+	}
+}
+
+func TestGetRouteMultiParams(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/files/:name.:ext", nil)
+	r.addRoute("GET", "/files/:name", nil)
+	r.addRoute("GET", "/date/:y<int>-:m<int>-:d<int>", nil)
+	r.addRoute("GET", "/api/v:major-:minor/users", nil)
+	r.addRoute("GET", "/api/v1/users", nil)
+	r.addRoute("GET", "/p/:id.html", nil)
+
+	cases := []struct {
+		path    string
+		pattern string
+		params  Params
+	}{
+		{"/files/archive.tar.gz", "/files/:name.:ext", Params{{"name", "archive.tar"}, {"ext", "gz"}}},
+		{"/files/a.b", "/files/:name.:ext", Params{{"name", "a"}, {"ext", "b"}}},
+		{"/files/a.b.c", "/files/:name.:ext", Params{{"name", "a.b"}, {"ext", "c"}}},
+		{"/files/archive", "/files/:name", Params{{"name", "archive"}}},
+		{"/files/a.", "/files/:name", Params{{"name", "a."}}},
+		{"/date/2020-01-02", "/date/:y<int>-:m<int>-:d<int>", Params{{"y", "2020"}, {"m", "01"}, {"d", "02"}}},
+		{"/api/v2-10/users", "/api/v:major-:minor/users", Params{{"major", "2"}, {"minor", "10"}}},
+		{"/api/v1/users", "/api/v1/users", Params{}},
+		{"/p/12.html", "/p/:id.html", Params{{"id", "12"}}},
+	}
+	for _, c := range cases {
+		n, ps := getRoute(r, "GET", c.path)
+		if n == nil || n.pattern != c.pattern || !reflect.DeepEqual(ps, c.params) {
+			t.Fatalf("%s should match %s with %v, got %v %v", c.path, c.pattern, c.params, n, ps)
+		}
+	}
+
+	for _, path := range []string{"/files/", "/date/2020-01", "/date/2020-a-02", "/p/12"} {
+		if n, _ := getRoute(r, "GET", path); n != nil {
+			t.Fatalf("%s should not be matched, got %v", path, n)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("adjacent params should panic")
+			}
+		}()
+		newRouter().addRoute("GET", "/:a:b", nil)
+	}()
+}
@@ -1,15 +1,18 @@
 package gig
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
 	"path"
-	"regexp"
 	"strings"
 )
 
 // 定义路由分组
 type RouterGroup struct {
 	prefix      string
+	host        string        // 只匹配该 Host 的请求，为空时匹配所有请求
 	middlewares []HandlerFunc // 支持中间件
 	parent      *RouterGroup  // 父分组，支持嵌套
 	engine      *Engine       // 分组持有引擎实例
@@ -20,82 +23,212 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 	engine := group.engine
 	newGroup := &RouterGroup{
 		prefix: group.prefix + prefix,
+		host:   group.host,
 		parent: group,
 		engine: engine,
 	}
-	engine.groups = append(engine.groups, newGroup)
 	return newGroup
 }
 
 // 添加中间件到group
+// 中间件在注册路由时绑定到路由上，因此只对之后注册的路由生效
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
 // 新增路由
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
-	pattern := group.prefix + comp
-	group.engine.router.addRoute(method, pattern, handler)
+// handlers 为该路由独有的处理链，最后一个通常是业务处理方法，前面的可作为路由级中间件
+func (group *RouterGroup) addRoute(method string, comp string, handlers []HandlerFunc) *Route {
+	return group.register(group.newRoute(method, comp, handlers))
+}
+
+// 创建路由信息，合并分组中间件
+func (group *RouterGroup) newRoute(method string, comp string, handlers []HandlerFunc) *Route {
+	if len(handlers) == 0 {
+		panic("there must be at least one handler for route " + method + " " + group.prefix + comp)
+	}
+	pattern := _cleanPattern(group.prefix + comp)
+	route := &Route{
+		Method:      method,
+		Path:        pattern,
+		host:        group.host,
+		handlers:    group.combineHandlers(handlers),
+		engine:      group.engine,
+		routerType:  routerTypeGig,
+		handlerName: nameOfFunction(handlers[len(handlers)-1]),
+	}
+	return route
+}
+
+// 注册路由，注册后路由信息不能再修改
+func (group *RouterGroup) register(route *Route) *Route {
+	group.engine.updateRoutes(func(t *routeTable) {
+		t.add(route)
+	})
 
 	if IsDebugging() {
-		debugPrint("Route  %5s - %s", method, pattern)
+		debugPrint("Route  %5s - %s%s", route.Method, route.host, route.Path)
 	}
+	return route
+}
+
+// 合并所有祖先分组的中间件和路由处理链
+// 执行顺序为 根分组 -> ... -> 当前分组 -> 路由处理链
+func (group *RouterGroup) combineHandlers(handlers []HandlerFunc) []HandlerFunc {
+	size := len(handlers)
+	for g := group; g != nil; g = g.parent {
+		size += len(g.middlewares)
+	}
+	if size >= int(abortIndex) {
+		panic("too many handlers")
+	}
+
+	merged := make([]HandlerFunc, size)
+	end := size - copy(merged[size-len(handlers):], handlers)
+	for g := group; g != nil; g = g.parent {
+		end -= copy(merged[end-len(g.middlewares):end], g.middlewares)
+	}
+	return merged
 }
 
 // Handle
 // For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
 // functions can be used.
-func (group *RouterGroup) Handle(httpMethod, relativePath string, handler HandlerFunc) {
-	if matches, err := regexp.MatchString("^[A-Z]+$", httpMethod); !matches || err != nil {
+// httpMethod can be any valid token, including custom methods such as
+// PROPFIND and MKCOL. "ANY" is the same as calling ANY.
+func (group *RouterGroup) Handle(httpMethod, relativePath string, handlers ...HandlerFunc) *Route {
+	if !validMethod(httpMethod) {
 		panic("http method " + httpMethod + " is not valid")
 	}
-	group.addRoute(httpMethod, relativePath, handler)
+	return group.addRoute(httpMethod, relativePath, handlers)
+}
+
+// Match 为多个请求方式注册相同的处理链
+func (group *RouterGroup) Match(methods []string, relativePath string, handlers ...HandlerFunc) []*Route {
+	routes := make([]*Route, 0, len(methods))
+	for _, method := range methods {
+		routes = append(routes, group.Handle(method, relativePath, handlers...))
+	}
+	return routes
 }
 
 // GET路由
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodGet, pattern, handler)
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodGet, pattern, handlers)
 }
 
 // POST路由
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodPost, pattern, handler)
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodPost, pattern, handlers)
 }
 
 // DELETE路由
-func (group *RouterGroup) DELETE(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodDelete, pattern, handler)
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodDelete, pattern, handlers)
 }
 
 // PATCH路由
-func (group *RouterGroup) PATCH(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodPatch, pattern, handler)
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodPatch, pattern, handlers)
 }
 
 // PUT路由
-func (group *RouterGroup) PUT(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodPut, pattern, handler)
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodPut, pattern, handlers)
 }
 
 // OPTIONS路由
-func (group *RouterGroup) OPTIONS(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodOptions, pattern, handler)
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodOptions, pattern, handlers)
 }
 
 // HEAD路由
-func (group *RouterGroup) HEAD(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodHead, pattern, handler)
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(http.MethodHead, pattern, handlers)
 }
 
 // ANY路由
-func (group *RouterGroup) ANY(pattern string, handler HandlerFunc) {
-	group.addRoute(http.MethodPost, pattern, handler)
-	group.addRoute(http.MethodGet, pattern, handler)
-	group.addRoute(http.MethodDelete, pattern, handler)
-	group.addRoute(http.MethodPatch, pattern, handler)
-	group.addRoute(http.MethodPut, pattern, handler)
-	group.addRoute(http.MethodOptions, pattern, handler)
-	group.addRoute(http.MethodHead, pattern, handler)
+// 匹配所有标准请求方式，以及通过 Handle 注册过的自定义请求方式，包括之后才注册的
+// 同一路由上单独注册的请求方式优先，无论在 ANY 之前还是之后注册，如 ANY /x 和 GET /x 同时存在时 GET 请求由后者处理
+func (group *RouterGroup) ANY(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRoute(methodAny, pattern, handlers)
+}
+
+// Mount 把 http.Handler 挂载到 prefix 下，prefix 及其下的所有路径和请求方式都交给 handler 处理
+// handler 收到的请求路径会去掉 prefix，如挂载到 /admin 时 /admin/users 变为 /users，/admin 变为 /
+// prefix 中可以包含参数，也可以挂载另一个 *Engine 作为子应用：
+//
+//	admin := gig.New()
+//	admin.GET("/users", listUsers)
+//	engine.Mount("/admin", admin)
+func (group *RouterGroup) Mount(prefix string, handler http.Handler) {
+	prefix = _cleanPattern(prefix)
+	if strings.HasSuffix(prefix, "/") && prefix != "/" {
+		prefix = prefix[:len(prefix)-1]
+	}
+	handlers := []HandlerFunc{mountHandler(handler)}
+
+	patterns := []string{prefix, prefix + "/", prefix + "/*path"}
+	if prefix == "/" {
+		patterns = []string{"/", "/*path"}
+	}
+	for _, pattern := range patterns {
+		route := group.newRoute(methodAny, pattern, handlers)
+		route.routerType = routerTypeHandler
+		route.handlerName = fmt.Sprintf("%T", handler)
+		group.register(route)
+	}
+}
+
+// 创建挂载 http.Handler 的处理方法，请求路径替换为 *path 匹配到的部分
+// 按转义后的路径匹配时，与 http.StripPrefix 一样同时设置解码后的 Path 和转义的 RawPath
+func mountHandler(handler http.Handler) HandlerFunc {
+	return func(c *Context) {
+		req := new(http.Request)
+		*req = *c.Request
+		u := new(url.URL)
+		*u = *req.URL
+		u.Path, u.RawPath = "/"+c.Param("path"), ""
+		if c.engine.UseRawPath && req.URL.RawPath != "" {
+			u.RawPath = mountRawPath(req.URL.RawPath, c.FullPath())
+			if p, err := url.PathUnescape(u.RawPath); err == nil {
+				u.Path = p
+			}
+		}
+		req.URL = u
+		if _, ok := handler.(*Engine); ok {
+			// 挂载的 *Engine 跳转时需要补上被去掉的前缀，嵌套挂载时前缀依次累加
+			prefix := strings.TrimSuffix(c.Request.URL.EscapedPath(), u.EscapedPath())
+			req = req.WithContext(context.WithValue(req.Context(), mountPrefixKey{}, mountPrefix(c.Request)+prefix))
+		}
+		handler.ServeHTTP(c.Writer, req)
+	}
+}
+
+// 请求上下文中保存挂载前缀的 key
+type mountPrefixKey struct{}
+
+// 请求被挂载的 *Engine 处理时，已去掉的转义后的路径前缀，如挂载到 /admin 时为 /admin
+func mountPrefix(req *http.Request) string {
+	prefix, _ := req.Context().Value(mountPrefixKey{}).(string)
+	return prefix
+}
+
+// 转义的请求路径中 *path 对应的部分，如 /files/*path 匹配 /files/a%2Fb 时为 /a%2Fb
+// 转义的路径中 %2F 不是路由段分隔符，因此按 pattern 中 *path 之前的 / 个数截取
+func mountRawPath(rawPath, pattern string) string {
+	i := strings.Index(pattern, "/*")
+	if i < 0 {
+		return "/"
+	}
+	for n := strings.Count(pattern[:i+1], "/"); n > 0; n-- {
+		j := strings.IndexByte(rawPath, '/')
+		if j < 0 {
+			return "/"
+		}
+		rawPath = rawPath[j+1:]
+	}
+	return "/" + rawPath
 }
 
 // 静态文件
@@ -0,0 +1,228 @@
+package gig
+
+import (
+	"sync/atomic"
+
+	"github.com/izuojian/gig/internal/utils"
+)
+
+// 路由表，保存全部路由定义和据此增量构建的 router
+// router 只用于注册时检查冲突和记录路由名称，不会交给 ServeHTTP 使用；
+// 发布时根据路由定义构建新的 router，再原子地替换 Engine 正在使用的 router
+type routeTable struct {
+	hosts   []string // 通过 Engine.Host 注册的 host，按注册顺序
+	routes  []*Route // 全部路由定义，按注册顺序
+	methods []string // 已注册的自定义请求方式，ANY 同样匹配这些请求方式
+	router  *router
+	nodes   map[routeKey]*node // 各请求方式下路由终点节点，用于 ANY 与单独注册的请求方式之间的覆盖
+}
+
+// 路由终点节点的索引
+type routeKey struct {
+	host, method, pattern string
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{
+		router: newRouter(),
+		nodes:  make(map[routeKey]*node),
+	}
+}
+
+// RouteRegistrar 注册和删除路由的接口，*RouterGroup 实现了该接口，用于 Engine.UpdateRoutes
+// 分组中间件只作用于之后注册的路由，因此不包含 Use，全局中间件通过 Engine.Use 修改
+type RouteRegistrar interface {
+	Group(prefix string) *RouterGroup
+	Handle(httpMethod, relativePath string, handlers ...HandlerFunc) *Route
+	GET(pattern string, handlers ...HandlerFunc) *Route
+	POST(pattern string, handlers ...HandlerFunc) *Route
+	DELETE(pattern string, handlers ...HandlerFunc) *Route
+	PATCH(pattern string, handlers ...HandlerFunc) *Route
+	PUT(pattern string, handlers ...HandlerFunc) *Route
+	OPTIONS(pattern string, handlers ...HandlerFunc) *Route
+	HEAD(pattern string, handlers ...HandlerFunc) *Route
+	ANY(pattern string, handlers ...HandlerFunc) *Route
+	Match(methods []string, relativePath string, handlers ...HandlerFunc) []*Route
+	RemoveRoute(httpMethod, relativePath string) bool
+}
+
+// 根据路由定义重新构建路由表，keep 返回 false 的路由会被去掉
+func (t *routeTable) rebuild(keep func(route *Route) bool) *routeTable {
+	nt := newRouteTable()
+	nt.hosts = append(nt.hosts, t.hosts...)
+	nt.routes = make([]*Route, 0, len(t.routes))
+	for _, host := range nt.hosts {
+		nt.router.hostRouter(host)
+	}
+	paths := make(map[routeName]bool, len(t.routes))
+	for _, route := range t.routes {
+		if keep == nil || keep(route) {
+			nt.add(route)
+			paths[routeName{route.host, route.Path}] = true
+		}
+	}
+	// 同一 Host 下的路由全部删除后，其名称也一并删除
+	for name, rn := range t.router.names {
+		if paths[rn] {
+			nt.router.names[name] = rn
+		}
+	}
+	return nt
+}
+
+// 添加路由定义
+// ANY 路由添加到所有标准和自定义请求方式下，首次出现的自定义请求方式补上之前注册的 ANY 路由。
+// 同一路由上单独注册的请求方式优先于 ANY，与注册顺序无关；ANY 之间、单独注册的请求方式之间重复时 panic
+func (t *routeTable) add(route *Route) {
+	if route.Method == methodAny {
+		for _, method := range anyMethods {
+			t.insertAny(route, method)
+		}
+		for _, method := range t.methods {
+			t.insertAny(route, method)
+		}
+		t.routes = append(t.routes, route)
+		return
+	}
+
+	if n := t.nodes[routeKey{route.host, route.Method, route.Path}]; n != nil && n.route.Method == methodAny {
+		// 替换 ANY 路由在该请求方式下的处理链
+		n.handlers, n.route = route.handlers, route
+	} else {
+		t.insert(route, route.Method)
+	}
+	t.routes = append(t.routes, route)
+	if HTTPMETHODS[route.Method] || utils.InSlice(route.Method, t.methods) {
+		return
+	}
+	t.methods = append(t.methods, route.Method)
+	for _, r := range t.routes {
+		if r.Method == methodAny {
+			t.insertAny(r, route.Method)
+		}
+	}
+}
+
+// 把 ANY 路由插入到指定请求方式下，该请求方式下已单独注册了相同路由时跳过
+func (t *routeTable) insertAny(route *Route, method string) {
+	if n := t.nodes[routeKey{route.host, method, route.Path}]; n != nil && n.route.Method != methodAny {
+		return
+	}
+	t.insert(route, method)
+}
+
+// 把路由插入到指定请求方式下
+func (t *routeTable) insert(route *Route, method string) {
+	n := t.router.addHostRoute(route.host, method, route.Path, route.handlers)
+	n.route = route
+	t.nodes[routeKey{route.host, method, route.Path}] = n
+}
+
+// 添加 host
+func (t *routeTable) addHost(host string) {
+	h := t.router.hostRouter(host)
+	for _, registered := range t.hosts {
+		if registered == h.host {
+			return
+		}
+	}
+	t.hosts = append(t.hosts, h.host)
+}
+
+// 删除路由定义并重新构建 router，不存在时返回 false
+func (t *routeTable) remove(host, method, pattern string) bool {
+	removed := false
+	nt := t.rebuild(func(route *Route) bool {
+		if route.host == host && route.Method == method && route.Path == pattern {
+			removed = true
+			return false
+		}
+		return true
+	})
+	if removed {
+		*t = *nt
+	}
+	return removed
+}
+
+// 在可修改的路由表上执行 fn
+// UpdateRoutes 执行期间修改其新建的路由表，否则直接修改当前路由表，下一次获取路由时一并发布
+func (engine *Engine) updateRoutes(fn func(t *routeTable)) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	t := engine.pending
+	if t == nil {
+		t = engine.table
+	}
+	fn(t)
+	if engine.pending == nil {
+		atomic.StoreInt32(&engine.dirty, 1)
+	}
+}
+
+// 获取当前路由，有未发布的修改时先发布
+func (engine *Engine) getRouter() *router {
+	if atomic.LoadInt32(&engine.dirty) == 1 {
+		engine.mu.Lock()
+		if atomic.LoadInt32(&engine.dirty) == 1 {
+			engine.publish(engine.table)
+		}
+		engine.mu.Unlock()
+	}
+	return engine.current.Load().(*router)
+}
+
+// 发布路由表，调用方需持有 engine.mu
+// 路由表之后仍会被修改，因此根据路由定义构建一个新的只读 router 发布，连续的修改只在发布时构建一次；
+// 合并全局中间件后的 404、405 和 OPTIONS 处理链同样保存在发布的 router 中
+func (engine *Engine) publish(t *routeTable) {
+	engine.table = t
+	r := t.rebuild(nil).router
+	r.noRoute = engine.combineFallback(engine.noRoute, defaultNoRoute)
+	r.noMethod = engine.combineFallback(engine.noMethod, defaultNoMethod)
+	r.options = engine.combineFallback(engine.options, defaultOptions)
+	engine.current.Store(r)
+	atomic.StoreInt32(&engine.dirty, 0)
+}
+
+// UpdateRoutes 在当前路由的副本上执行 fn，fn 正常返回后原子地替换正在使用的路由，
+// fn panic 时正在使用的路由保持不变。fn 执行期间其他分组注册的路由同样加入新路由，
+// 多个 UpdateRoutes 依次执行，可以在服务运行时安全地添加和删除路由：
+//
+//	engine.UpdateRoutes(func(r gig.RouteRegistrar) {
+//	    r.RemoveRoute("GET", "/plugins/old")
+//	    r.Group("/plugins/new").GET("/status", status)
+//	})
+func (engine *Engine) UpdateRoutes(fn func(r RouteRegistrar)) {
+	engine.updating.Lock()
+	defer engine.updating.Unlock()
+
+	engine.mu.Lock()
+	engine.pending = engine.table.rebuild(nil)
+	engine.mu.Unlock()
+
+	committed := false
+	defer func() {
+		engine.mu.Lock()
+		if committed {
+			engine.publish(engine.pending)
+		}
+		engine.pending = nil
+		engine.mu.Unlock()
+	}()
+
+	fn(engine.RouterGroup)
+	committed = true
+}
+
+// RemoveRoute 删除分组下的路由，路由不存在时返回 false
+// 删除后不再有路由使用的路由名称同时被删除
+func (group *RouterGroup) RemoveRoute(httpMethod, relativePath string) bool {
+	pattern := _cleanPattern(group.prefix + relativePath)
+	removed := false
+	group.engine.updateRoutes(func(t *routeTable) {
+		removed = t.remove(group.host, httpMethod, pattern)
+	})
+	return removed
+}
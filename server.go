@@ -0,0 +1,218 @@
+package gig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// 默认的优雅关闭超时时间
+const defaultShutdownTimeout = 10 * time.Second
+
+// 服务器配置，零值表示使用 http.Server 的默认值
+type ServerConfig struct {
+	Addr              string        // 监听地址，如 :8080
+	Listener          net.Listener  // 已创建的 listener，设置后忽略 Addr，如 unix socket、systemd 传入的 socket
+	ReadTimeout       time.Duration // 读取整个请求的超时时间，包括请求体
+	ReadHeaderTimeout time.Duration // 读取请求头的超时时间
+	WriteTimeout      time.Duration // 写响应的超时时间
+	IdleTimeout       time.Duration // keep-alive 连接的空闲超时时间
+	MaxHeaderBytes    int           // 请求头的最大字节数
+
+	// 收到退出信号或 ctx 取消后，等待进行中的请求完成的最长时间，默认 10s
+	ShutdownTimeout time.Duration
+	// 触发优雅关闭的信号，默认 SIGINT 和 SIGTERM
+	Signals []os.Signal
+
+	CertFile     string      // 证书文件，与 KeyFile 同时设置时运行 https server
+	KeyFile      string      // 私钥文件
+	ClientCAFile string      // 客户端证书的 CA 文件，设置后要求并校验客户端证书
+	TLSConfig    *tls.Config // 自定义 TLS 配置，证书和客户端 CA 仍以上面的文件为准
+	// 运行 https server 时，同时在该地址监听 HTTP 请求并重定向到 HTTPS，如 :80
+	RedirectHTTPAddr string
+
+	// 收到 SIGHUP 或 SIGUSR2 时无缝重启：启动新的可执行文件并传入正在监听的 socket，
+	// 新进程就绪后当前进程优雅关闭并返回，仅支持 unix 系统。
+	// 只支持通过 Addr 监听的 TCP 服务，不能与 Listener 同时使用，如 unix socket
+	Reload bool
+	// 等待新进程就绪的最长时间，超时后终止新进程并继续运行，默认 30s
+	ReloadTimeout time.Duration
+}
+
+// 生命周期钩子
+type HookFunc func(ctx context.Context) error
+
+// OnStart 添加服务启动钩子，在开始监听之后、处理请求之前按添加顺序执行
+// 任意钩子返回错误时服务不会启动，RunWithContext 返回该错误
+func (engine *Engine) OnStart(hooks ...HookFunc) {
+	engine.onStart = append(engine.onStart, hooks...)
+}
+
+// OnShutdown 添加服务关闭钩子，在进行中的请求处理完成之后按添加的相反顺序执行，
+// 可用于关闭数据库连接池等资源，ctx 的超时时间为 ShutdownTimeout
+func (engine *Engine) OnShutdown(hooks ...HookFunc) {
+	engine.onShutdown = append(engine.onShutdown, hooks...)
+}
+
+// Server 根据配置创建 http.Server，Handler 为 engine
+func (engine *Engine) Server(config ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           engine,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+}
+
+// RunWithContext 按配置运行http server，直到 ctx 取消或收到退出信号
+// 之后不再接受新连接，等待进行中的请求完成后执行关闭钩子，正常关闭时返回 nil
+func (engine *Engine) RunWithContext(ctx context.Context, config ServerConfig) error {
+	srv := engine.Server(config)
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsConfig
+
+	addr, scheme := srv.Addr, "HTTP"
+	if addr == "" {
+		addr = ":http"
+		if tlsConfig != nil {
+			addr = ":https"
+		}
+	}
+	if tlsConfig != nil {
+		scheme = "HTTPS"
+	}
+
+	// 无缝重启后的新进程直接使用旧进程传入的 listener
+	var inherited []net.Listener
+	if config.Reload {
+		// 新进程会重新执行创建 Listener 的代码，而此时 socket 仍被旧进程占用
+		if config.Listener != nil {
+			return errors.New("reload only supports servers listening on Addr, not a custom Listener")
+		}
+		if inherited, err = inheritedListeners(); err != nil {
+			return err
+		}
+	}
+	ln := config.Listener
+	if len(inherited) > 0 {
+		ln = inherited[0]
+	}
+	if ln == nil {
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return err
+		}
+	}
+	listeners := []net.Listener{ln}
+
+	if tlsConfig != nil && config.RedirectHTTPAddr != "" {
+		var redirectLn net.Listener
+		if len(inherited) > 1 {
+			redirectLn = inherited[1]
+		} else if redirectLn, err = net.Listen("tcp", config.RedirectHTTPAddr); err != nil {
+			_ = ln.Close()
+			return err
+		}
+		listeners = append(listeners, redirectLn)
+		redirectSrv := &http.Server{
+			Handler:           redirectHTTPS(ln.Addr().String()),
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+		}
+		go func() {
+			_ = redirectSrv.Serve(redirectLn)
+		}()
+		defer redirectSrv.Close()
+		debugPrint("HTTP server redirecting to HTTPS on%s %s %s", ConsoleFrontColorCyan, redirectLn.Addr(), ConsoleFrontColorReset)
+	}
+
+	if config.Reload {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		stop, err := watchReload(listeners, config.ReloadTimeout, cancel)
+		if err != nil {
+			_ = ln.Close()
+			return err
+		}
+		defer stop()
+	}
+
+	debugPrint("Running in \"%s\" mode", Mode())
+	debugPrint("%s server running on%s %s %s", scheme, ConsoleFrontColorCyan, ln.Addr(), ConsoleFrontColorReset)
+	return engine.serve(ctx, srv, ln, config)
+}
+
+// 在 ln 上运行 srv，负责信号处理、优雅关闭和生命周期钩子
+func (engine *Engine) serve(ctx context.Context, srv *http.Server, ln net.Listener, config ServerConfig) error {
+	signals := config.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+	defer stop()
+
+	for _, hook := range engine.onStart {
+		if err := hook(ctx); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
+
+	// 由旧进程启动时通知旧进程已就绪，旧进程随后优雅关闭
+	if config.Reload {
+		notifyReady()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			// 证书由 TLSConfig.GetCertificate 提供，ServeTLS 会同时开启 HTTP/2
+			serveErr <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- srv.Serve(ln)
+	}()
+
+	timeout := config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-ctx.Done():
+		debugPrint("HTTP server shutting down, waiting up to %s for active requests", timeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		err = srv.Shutdown(shutdownCtx)
+		if e := <-serveErr; err == nil && !errors.Is(e, http.ErrServerClosed) {
+			err = e
+		}
+	}
+
+	// 关闭钩子总是执行，即使服务异常退出
+	hookCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for i := len(engine.onShutdown) - 1; i >= 0; i-- {
+		if e := engine.onShutdown[i](hookCtx); err == nil {
+			err = e
+		}
+	}
+	return err
+}
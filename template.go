@@ -18,7 +18,7 @@ import (
 var (
 	templatesLock sync.RWMutex
 
-	gigTplFuncMap    = make(template.FuncMap)
+	gigTplFuncMap    = template.FuncMap{"urlfor": urlforUnbound}
 	gigTemplates     = make(map[string]*template.Template)
 	gigTplDelimLeft  = "{{"
 	gigTplDelimRight = "}}"
@@ -43,6 +43,11 @@ func AddFuncMap(key string, fn interface{}) error {
 	return nil
 }
 
+// LoadTemplates 加载的模板不属于任何 engine，urlfor 只能在 Engine.Templates 加载的模板中使用
+func urlforUnbound(name string, params ...interface{}) (string, error) {
+	return "", errors.New("urlfor " + name + ": templates must be loaded by Engine.Templates to generate URLs")
+}
+
 func defaultFSFunc() http.FileSystem {
 	return utils.FileSystem{}
 }
@@ -52,20 +57,45 @@ func defaultFSFunc() http.FileSystem {
 // A template will be executed safely in parallel.
 func ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
 	if t, ok := gigTemplates[name]; ok {
-		var err error
-		if t.Lookup(name) != nil {
-			err = t.ExecuteTemplate(wr, name, data)
-		} else {
-			err = t.Execute(wr, data)
-		}
-		if err != nil {
-			debugPrint("template Execute err: %v", err)
-		}
-		return err
+		return executeTemplate(t, wr, name, data)
 	}
 	panic("can't find templatefile in the path:" + name)
 }
 
+func executeTemplate(t *template.Template, wr io.Writer, name string, data interface{}) error {
+	var err error
+	if t.Lookup(name) != nil {
+		err = t.ExecuteTemplate(wr, name, data)
+	} else {
+		err = t.Execute(wr, data)
+	}
+	if err != nil {
+		debugPrint("template Execute err: %v", err)
+	}
+	return err
+}
+
+// 模板函数，包括通过 AddFuncMap 注册的函数和生成该 engine 中命名路由URL的 urlfor
+func (engine *Engine) tplFuncMap() template.FuncMap {
+	funcs := make(template.FuncMap, len(gigTplFuncMap)+1)
+	for key, fn := range gigTplFuncMap {
+		funcs[key] = fn
+	}
+	funcs["urlfor"] = engine.URLFor
+	return funcs
+}
+
+// 渲染模板，优先使用 Engine.Templates 加载的模板，不存在时使用 LoadTemplates 加载的模板
+func (engine *Engine) executeTemplate(wr io.Writer, name string, data interface{}) error {
+	templatesLock.RLock()
+	t, ok := engine.templates[name]
+	templatesLock.RUnlock()
+	if !ok {
+		return ExecuteTemplate(wr, name, data)
+	}
+	return executeTemplate(t, wr, name, data)
+}
+
 // visit will make the paths into two part,the first is subDir (without tf.root),the second is full path(without tf.root).
 // if tf.root="views" and
 // paths is "views/errors/404.html",the subDir will be "errors",the file will be "errors/404.html"
@@ -102,14 +132,28 @@ func HasTemplateExt(paths string) bool {
 // BuildTemplate will build all template files in a directory.
 // it makes gig can render any template file in view directory.
 func LoadTemplates(dir string) error {
+	templates, err := buildTemplates(dir, gigTplFuncMap)
+	if err != nil {
+		return err
+	}
+	templatesLock.Lock()
+	for file, t := range templates {
+		gigTemplates[file] = t
+	}
+	templatesLock.Unlock()
+	return nil
+}
+
+// 使用 funcs 解析目录下的全部模板文件
+func buildTemplates(dir string, funcs template.FuncMap) (map[string]*template.Template, error) {
 	var err error
 	fs := gigTemplateFS()
 	f, err := fs.Open(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return nil, nil
 		}
-		return errors.New("dir open err")
+		return nil, errors.New("dir open err")
 	}
 	defer f.Close()
 
@@ -122,34 +166,32 @@ func LoadTemplates(dir string) error {
 	})
 	if err != nil {
 		fmt.Printf("Walk() returned %v\n", err)
-		return err
+		return nil, err
 	}
 
+	templates := make(map[string]*template.Template)
 	for _, v := range self.files {
 		for _, file := range v {
-			templatesLock.Lock()
 			ext := filepath.Ext(file)
 			var t *template.Template
 			if len(ext) == 0 {
-				t, err = getTemplate(self.root, fs, file, v...)
+				t, err = getTemplate(self.root, fs, funcs, file, v...)
 			} else if fn, ok := gigTemplateEngines[ext[1:]]; ok {
-				t, err = fn(self.root, file, gigTplFuncMap)
+				t, err = fn(self.root, file, funcs)
 			} else {
-				t, err = getTemplate(self.root, fs, file, v...)
+				t, err = getTemplate(self.root, fs, funcs, file, v...)
 			}
 			if err != nil {
 				debugPrint("parse template err:", file, err)
-				templatesLock.Unlock()
-				return err
+				return nil, err
 			}
-			gigTemplates[file] = t
-			templatesLock.Unlock()
+			templates[file] = t
 			if IsDebugging() {
 				debugPrint("TPL: %4s", file)
 			}
 		}
 	}
-	return nil
+	return templates, nil
 }
 
 func getTplDeep(root string, fs http.FileSystem, file string, parent string, t *template.Template) (*template.Template, [][]string, error) {
@@ -196,8 +238,8 @@ func getTplDeep(root string, fs http.FileSystem, file string, parent string, t *
 	return t, allSub, nil
 }
 
-func getTemplate(root string, fs http.FileSystem, file string, others ...string) (t *template.Template, err error) {
-	t = template.New(file).Delims(gigTplDelimLeft, gigTplDelimRight).Funcs(gigTplFuncMap)
+func getTemplate(root string, fs http.FileSystem, funcs template.FuncMap, file string, others ...string) (t *template.Template, err error) {
+	t = template.New(file).Delims(gigTplDelimLeft, gigTplDelimRight).Funcs(funcs)
 	var subMods [][]string
 	t, subMods, err = getTplDeep(root, fs, file, "", t)
 	if err != nil {
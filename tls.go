@@ -0,0 +1,208 @@
+package gig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// RunTLS 运行https server，同时支持 HTTP/2，证书文件修改后自动加载，无需重启
+func (engine *Engine) RunTLS(addr, certFile, keyFile string) error {
+	return engine.RunWithContext(context.Background(), ServerConfig{
+		Addr:     addr,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	})
+}
+
+// RunMTLS 运行要求客户端证书的https server，客户端证书必须由 clientCAFile 中的 CA 签发
+// 处理方法中可以通过 Context.ClientCertificate 获取校验通过的客户端证书
+func (engine *Engine) RunMTLS(addr, certFile, keyFile, clientCAFile string) error {
+	return engine.RunWithContext(context.Background(), ServerConfig{
+		Addr:         addr,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCAFile,
+	})
+}
+
+// 根据配置创建 TLS 配置，未配置证书时返回 nil
+// 证书和私钥只设置了一个，或未设置证书却设置了 ClientCAFile 等 https 专用的配置时返回错误，避免静默运行 http server
+func (config ServerConfig) tlsConfig() (*tls.Config, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("CertFile and KeyFile must be set together")
+	}
+	if config.CertFile == "" {
+		if config.ClientCAFile != "" || config.TLSConfig != nil || config.RedirectHTTPAddr != "" {
+			return nil, errors.New("ClientCAFile, TLSConfig and RedirectHTTPAddr require CertFile and KeyFile")
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	reloader, err := newCertReloader(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+
+	if config.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no certificates found in client CA file " + config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// 证书文件大小和修改时间都未变化时，重新读取文件内容的最短间隔
+// 用于发现同一修改时间精度内写入的新证书
+const certCheckInterval = time.Second
+
+// 证书热加载，每次握手时检查证书和私钥文件的大小和修改时间，变化后立即读取，
+// 未变化时最多每 certCheckInterval 读取一次，内容变化后重新加载。
+// 新证书加载失败时继续使用旧证书，如证书和私钥只更新了一个，同一份错误的内容只解析和警告一次
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+	version certVersion // 最近一次读取时的文件版本
+	checked time.Time   // 最近一次读取文件的时间
+
+	badCertPEM []byte // 最近一次加载失败的内容
+	badKeyPEM  []byte
+	badErr     error
+}
+
+// 证书和私钥文件的大小和修改时间
+type certVersion struct {
+	certSize, keySize int64
+	certTime, keyTime int64
+}
+
+// 创建证书热加载，并加载一次证书
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	version, err := r.stat()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if r.cert == nil {
+			return nil, err
+		}
+		return r.cert, nil
+	}
+	if r.cert != nil && version == r.version && time.Since(r.checked) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.version, r.checked = version, time.Now()
+	return r.load()
+}
+
+// 获取证书和私钥文件的版本
+func (r *certReloader) stat() (certVersion, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return certVersion{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return certVersion{}, err
+	}
+	return certVersion{
+		certSize: certInfo.Size(),
+		keySize:  keyInfo.Size(),
+		certTime: certInfo.ModTime().UnixNano(),
+		keyTime:  keyInfo.ModTime().UnixNano(),
+	}, nil
+}
+
+// 读取证书文件，内容有变化时重新加载，调用方需持有 r.mu
+func (r *certReloader) load() (*tls.Certificate, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	var keyPEM []byte
+	if err == nil {
+		keyPEM, err = os.ReadFile(r.keyFile)
+	}
+	if err != nil {
+		if r.cert == nil {
+			return nil, err
+		}
+		return r.cert, nil
+	}
+	if r.cert != nil && bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) {
+		return r.cert, nil
+	}
+	// 与上次加载失败的内容相同时不再重复解析和警告
+	if r.badErr != nil && bytes.Equal(certPEM, r.badCertPEM) && bytes.Equal(keyPEM, r.badKeyPEM) {
+		if r.cert == nil {
+			return nil, r.badErr
+		}
+		return r.cert, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		r.badCertPEM, r.badKeyPEM, r.badErr = certPEM, keyPEM, err
+		if r.cert == nil {
+			return nil, err
+		}
+		debugPrint("[WARNING] reload certificate %s failed, keep using the old one: %v", r.certFile, err)
+		return r.cert, nil
+	}
+	if r.cert != nil {
+		debugPrint("Certificate %s reloaded", r.certFile)
+	}
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	r.badCertPEM, r.badKeyPEM, r.badErr = nil, nil, nil
+	return r.cert, nil
+}
+
+// 把 HTTP 请求重定向到 httpsAddr 端口上的 HTTPS
+func redirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" && port != "https" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		code := http.StatusPermanentRedirect
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), code)
+	})
+}
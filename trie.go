@@ -2,66 +2,303 @@ package gig
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// 路由参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// 路由参数列表，顺序与 pattern 中参数出现的顺序一致
+type Params []Param
+
+// Get 获取第一个名称为 name 的参数值
+func (ps Params) Get(name string) (string, bool) {
+	for _, entry := range ps {
+		if entry.Key == name {
+			return entry.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName 获取第一个名称为 name 的参数值，不存在时返回空字符串
+func (ps Params) ByName(name string) string {
+	value, _ := ps.Get(name)
+	return value
+}
+
+type nodeType uint8
+
+const (
+	nodeStatic   nodeType = iota // 静态节点，如 /users/
+	nodeParam                    // 参数节点，如 :id
+	nodeCatchAll                 // 通配节点，如 *filepath
+)
+
+// 压缩前缀树(Radix Tree)节点
+// 静态路由按公共前缀合并，子节点通过首字节索引查找；
+// 匹配优先级：静态 > 带约束的参数 > 参数 > 通配，同一位置可以挂多个约束不同的参数子节点
 type node struct {
-	pattern  string  // 待匹配路由，驶入 /p/:lang
-	part     string  // 路由中的一部分，例如 :lang
-	children []*node // 子节点， 例如[doc, toturial, intro]
-	isWild   bool    // 是否精确匹配，part含有 ：或 * 时为true
+	pattern       string            // 完整路由，非空表示该节点是一个路由终点，例如 /p/:lang/doc
+	path          string            // 静态节点为压缩后的路径片段，参数节点为 :lang，通配节点为 *filepath
+	key           string            // 参数名，仅参数节点和通配节点使用
+	constraint    string            // 参数约束，如 :id<int> 中的 int
+	match         func(string) bool // 参数约束的校验方法，无约束时为 nil
+	nType         nodeType          // 节点类型
+	inSegment     bool              // 参数节点后是否紧跟同一路由段内的静态分隔符，如 :file.:ext 中的 .
+	indices       string            // 静态子节点的首字节，与 children 一一对应
+	children      []*node           // 静态子节点
+	paramChildren []*node           // 参数子节点，带约束的排在前面
+	catchAllChild *node             // 通配子节点
+	handlers      []HandlerFunc     // 路由处理方法链，包括路由级中间件
+	route         *Route            // 注册时的路由信息
 }
 
 // String方法
 func (n *node) String() string {
-	return fmt.Sprintf("node{pattern=%s, part=%s, isWild=%t}", n.pattern, n.part, n.isWild)
+	return fmt.Sprintf("node{pattern=%s, path=%s, isWild=%t}", n.pattern, n.path, n.nType != nodeStatic)
+}
+
+// 插入路由
+// 按 静态片段 -> 参数 -> 静态片段 ... 的顺序逐段插入，最后一个节点保存 pattern 和 handlers
+func (n *node) insert(pattern string, handlers []HandlerFunc) *node {
+	cur := n
+	for i := 0; i < len(pattern); {
+		start := findWildcard(pattern, i)
+		if start < 0 {
+			cur = cur.insertStatic(pattern[i:])
+			break
+		}
+		cur = cur.insertStatic(pattern[i:start])
+
+		var end int
+		if pattern[start] == '*' {
+			if strings.IndexByte(pattern[start:], '/') != -1 {
+				panic("catch-all routes are only allowed at the end of the path in path '" + pattern + "'")
+			}
+			end = len(pattern)
+		} else {
+			end = paramEnd(pattern, start)
+			// 同一路由段内的多个参数之间必须有静态分隔符，如 :y-:m-:d
+			if end < len(pattern) && pattern[end] == ':' {
+				panic("wildcards must be separated by static text in path '" + pattern + "'")
+			}
+		}
+		cur = cur.insertWild(pattern[start:end], pattern)
+		i = end
+	}
+
+	// 同一路由重复注册直接panic，避免静默覆盖
+	if cur.pattern != "" {
+		panic("handlers are already registered for path '" + pattern +
+			"', conflicts with existing '" + cur.pattern + "'")
+	}
+	cur.pattern = pattern
+	cur.handlers = handlers
+	return cur
 }
 
-// 插入新的节点
-// 递归查找每一层的节点，如果没有匹配到当前 part 的节点，则新建一个
-// 有一点需要注意，/p/:lang/doc 只有在第三层节点，即 doc 节点，pattern 才会设置为 /p/:lang/doc
-func (n *node) insert(pattern string, parts []string, height int) {
-	// 每递归一次深度+1，如果节点数等于递归深度则退出
-	if len(parts) == height {
-		n.pattern = pattern
-		return
+// 插入静态片段，必要时拆分已有节点，返回片段末尾对应的节点
+func (n *node) insertStatic(path string) *node {
+	for len(path) > 0 {
+		i := n.staticIndex(path[0])
+		if i < 0 {
+			child := &node{path: path, nType: nodeStatic}
+			if n.nType == nodeParam && path[0] != '/' {
+				n.inSegment = true
+			}
+			n.indices += string(path[0])
+			n.children = append(n.children, child)
+			return child
+		}
+
+		child := n.children[i]
+		l := longestCommonPrefix(path, child.path)
+		if l < len(child.path) {
+			// 拆分节点，如 /users/new 拆分为 /users/ 和 new
+			parent := &node{
+				path:     child.path[:l],
+				nType:    nodeStatic,
+				indices:  string(child.path[l]),
+				children: []*node{child},
+			}
+			child.path = child.path[l:]
+			n.children[i] = parent
+			child = parent
+		}
+		n = child
+		path = path[l:]
 	}
-	part := parts[height]
-	child := n.matchChild(part)
-	if child == nil {
-		// 新建前缀树节点
-		child = &node{
-			part:   part,
-			isWild: part[0] == ':' || part[0] == '*',
+	return n
+}
+
+// 插入参数或通配节点
+// 同一位置约束相同的参数节点只能有一个，如 /a/:x 与 /a/:y、/a/:x<int> 与 /a/:y<int> 冲突
+func (n *node) insertWild(wild, pattern string) *node {
+	if wild[0] == '*' {
+		if child := n.catchAllChild; child != nil {
+			if child.path != wild {
+				panic("'" + wild + "' in new path '" + pattern +
+					"' conflicts with existing wildcard '" + child.path + "'")
+			}
+			return child
+		}
+		n.catchAllChild = &node{path: wild, key: wild[1:], nType: nodeCatchAll}
+		return n.catchAllChild
+	}
+
+	key, constraint := parseParam(wild)
+	for _, child := range n.paramChildren {
+		if child.constraint == constraint {
+			if child.path != wild {
+				panic("'" + wild + "' in new path '" + pattern +
+					"' conflicts with existing wildcard '" + child.path + "'")
+			}
+			return child
 		}
-		n.children = append(n.children, child)
 	}
-	child.insert(pattern, parts, height+1)
+
+	child := &node{
+		path:       wild,
+		key:        key,
+		constraint: constraint,
+		nType:      nodeParam,
+	}
+	if constraint != "" {
+		child.match = newParamMatcher(constraint, pattern)
+	}
+
+	// 带约束的参数节点排在无约束的参数节点之前，约束之间按注册顺序匹配
+	i := len(n.paramChildren)
+	if constraint != "" && i > 0 && n.paramChildren[i-1].constraint == "" {
+		i--
+	}
+	n.paramChildren = append(n.paramChildren, nil)
+	copy(n.paramChildren[i+1:], n.paramChildren[i:])
+	n.paramChildren[i] = child
+	return child
 }
 
 // 查找节点
-// 递归查询每一层的节点，退出规则是匹配到了 * 或匹配失败 或匹配到了 len(parts) 层节点
-func (n *node) search(parts []string, height int) *node {
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+// path 为当前节点之后尚未匹配的部分，匹配到的参数追加到 params
+// 优先匹配静态子节点，失败后依次回溯到参数子节点、通配子节点
+func (n *node) search(path string, params *Params) *node {
+	if path == "" {
 		if n.pattern == "" {
 			return nil
 		}
 		return n
 	}
 
-	part := parts[height]
-	children := n.matchChildren(part)
+	if i := n.staticIndex(path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.path) {
+			if result := child.search(path[len(child.path):], params); result != nil {
+				return result
+			}
+		}
+	}
 
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
+	// 参数后紧跟段内分隔符时，先从长到短尝试段内的分隔符位置，最后才把整个路由段作为参数值，
+	// 如同时注册 /files/:name 和 /files/:name.:ext 时，/files/a.b 匹配后者
+	segEnd := strings.IndexByte(path, '/')
+	if segEnd < 0 {
+		segEnd = len(path)
+	}
+	for _, child := range n.paramChildren {
+		if child.inSegment {
+			for end := segEnd - 1; end > 0; end-- {
+				if child.staticIndex(path[end]) < 0 {
+					continue
+				}
+				if result := child.searchParam(path, end, params); result != nil {
+					return result
+				}
+			}
+		}
+		if result := child.searchParam(path, segEnd, params); result != nil {
 			return result
 		}
 	}
 
+	if child := n.catchAllChild; child != nil && child.pattern != "" {
+		if child.key != "" {
+			*params = append(*params, Param{Key: child.key, Value: path})
+		}
+		return child
+	}
+
+	return nil
+}
+
+// 以 path[:end] 作为参数节点 n 的值继续查找，失败时去掉追加的参数
+func (n *node) searchParam(path string, end int, params *Params) *node {
+	value := path[:end]
+	if value == "" || (n.match != nil && !n.match(value)) {
+		return nil
+	}
+	size := len(*params)
+	*params = append(*params, Param{Key: n.key, Value: value})
+	if result := n.search(path[end:], params); result != nil {
+		return result
+	}
+	*params = (*params)[:size]
 	return nil
 }
 
+// 不区分大小写查找节点，用于 RedirectFixedPath
+// 静态部分替换为注册时的大小写，参数部分保持原样，匹配成功时返回修正后的完整路径
+func (n *node) searchCaseInsensitive(path string, buf []byte) ([]byte, bool) {
+	if path == "" {
+		return buf, n.pattern != ""
+	}
+
+	for _, child := range n.children {
+		if len(path) >= len(child.path) && strings.EqualFold(path[:len(child.path)], child.path) {
+			if result, ok := child.searchCaseInsensitive(path[len(child.path):], append(buf, child.path...)); ok {
+				return result, true
+			}
+		}
+	}
+
+	segEnd := strings.IndexByte(path, '/')
+	if segEnd < 0 {
+		segEnd = len(path)
+	}
+	for _, child := range n.paramChildren {
+		if child.inSegment {
+			for end := segEnd - 1; end > 0; end-- {
+				if result, ok := child.searchParamCaseInsensitive(path, end, buf); ok {
+					return result, true
+				}
+			}
+		}
+		if result, ok := child.searchParamCaseInsensitive(path, segEnd, buf); ok {
+			return result, true
+		}
+	}
+
+	if child := n.catchAllChild; child != nil && child.pattern != "" {
+		return append(buf, path...), true
+	}
+
+	return buf, false
+}
+
+// 以 path[:end] 作为参数节点 n 的值继续不区分大小写查找
+func (n *node) searchParamCaseInsensitive(path string, end int, buf []byte) ([]byte, bool) {
+	value := path[:end]
+	if value == "" || (n.match != nil && !n.match(value)) {
+		return buf, false
+	}
+	return n.searchCaseInsensitive(path[end:], append(buf, value...))
+}
+
 // 遍历节点
 func (n *node) travel(list *[]*node) {
 	if n.pattern != "" {
@@ -70,25 +307,171 @@ func (n *node) travel(list *[]*node) {
 	for _, child := range n.children {
 		child.travel(list)
 	}
+	for _, child := range n.paramChildren {
+		child.travel(list)
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.travel(list)
+	}
 }
 
-// 第一个匹配成功的节点，用于插入
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			return child
+// 首字节为 c 的静态子节点下标，不存在返回 -1
+func (n *node) staticIndex(c byte) int {
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] == c {
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
-// 所有匹配成功的节点，用于查找
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
+// 从 i 开始查找下一个参数或通配符的位置，不存在返回 -1
+// : 可以出现在路由段的任意位置，* 只能出现在路由段开头
+func findWildcard(path string, i int) int {
+	for ; i < len(path); i++ {
+		if path[i] == ':' || (path[i] == '*' && i > 0 && path[i-1] == '/') {
+			return i
+		}
+	}
+	return -1
+}
+
+// 参数的结束位置，参数名由字母、数字和 _ 组成，之后可以跟 <约束>
+func paramEnd(pattern string, start int) int {
+	end := start + 1
+	for end < len(pattern) && (isLetter(pattern[end]) || isDigit(pattern[end]) || pattern[end] == '_') {
+		end++
+	}
+	if end == start+1 {
+		panic("wildcards must be named with a non-empty name in path '" + pattern + "'")
+	}
+	if end == len(pattern) || pattern[end] != '<' {
+		return end
+	}
+
+	// 约束中可能包含正则表达式，按 <> 嵌套层数查找结束位置
+	depth := 0
+	for i := end; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				if i == end+1 {
+					panic("empty constraint in path '" + pattern + "'")
+				}
+				return i + 1
+			}
 		}
 	}
-	return nodes
+	panic("unclosed constraint in path '" + pattern + "'")
+}
+
+// 最长公共前缀长度
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
+	}
+	for i < max && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// 参数个数
+func countParams(pattern string) uint16 {
+	var n uint16
+	for i := findWildcard(pattern, 0); i >= 0; i = findWildcard(pattern, i) {
+		n++
+		if pattern[i] == '*' {
+			break
+		}
+		i = paramEnd(pattern, i)
+	}
+	return n
+}
+
+// 解析参数，如 :id<int> 解析为参数名 id 和约束 int
+func parseParam(wild string) (key, constraint string) {
+	if i := strings.IndexByte(wild, '<'); i != -1 {
+		return wild[1:i], wild[i+1 : len(wild)-1]
+	}
+	return wild[1:], ""
+}
+
+// 内置的参数约束
+var paramTypes = map[string]func(string) bool{
+	"int":   isInt,
+	"uuid":  isUUID,
+	"alpha": isAlpha,
+	"alnum": isAlnum,
+}
+
+// 根据约束创建参数校验方法，内置类型之外的约束作为正则表达式完整匹配参数值
+func newParamMatcher(constraint, pattern string) func(string) bool {
+	if match, ok := paramTypes[constraint]; ok {
+		return match
+	}
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		panic("invalid constraint '" + constraint + "' in path '" + pattern + "': " + err.Error())
+	}
+	return re.MatchString
+}
+
+func isInt(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isAlnum(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) && !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
 }
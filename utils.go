@@ -0,0 +1,20 @@
+package gig
+
+import (
+	"net/http"
+)
+
+// WrapF 把 http.HandlerFunc 转换为 HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Request)
+	}
+}
+
+// WrapH 把 http.Handler 转换为 HandlerFunc，请求路径保持不变
+// 需要去掉路由前缀时使用 RouterGroup.Mount
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}